@@ -12,12 +12,18 @@ import (
 	"runtime/debug"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/iskorotkov/router/internal/acme"
 	"github.com/iskorotkov/router/internal/admin"
+	"github.com/iskorotkov/router/internal/certs"
 	"github.com/iskorotkov/router/internal/discover"
+	"github.com/iskorotkov/router/internal/health"
+	"github.com/iskorotkov/router/internal/metrics"
 	"github.com/iskorotkov/router/internal/models"
 	"github.com/iskorotkov/router/internal/router"
 	"github.com/iskorotkov/router/internal/routing"
+	"github.com/iskorotkov/router/internal/stream"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -29,11 +35,28 @@ const (
 	dataFolderPermissions = os.FileMode(0777) //nolint:gofumpt
 
 	defaultPort      = 8080
+	defaultTLSPort   = 8443
+	defaultHTTP3Port = 8443
 	defaultAdminPort = 7676
+
+	defaultUpgradeIdleTimeout = 10 * time.Minute
+
+	defaultRetryBudget     = 0.2
+	defaultRetryBudgetMin  = 10
+	defaultRetryBufferSize = 1 << 20
+
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 5 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+
+	defaultACMERenewBefore = 30 * 24 * time.Hour
 )
 
 //nolint:gochecknoglobals
-var routes routing.Cache
+var (
+	routes       routing.Cache
+	certificates certs.Store
+)
 
 func main() {
 	defer func() {
@@ -73,10 +96,83 @@ func main() {
 	}()
 
 	adminPort := flag.Int("admin-port", defaultAdminPort, "admin port used for configuration and monitoring")
-	adminServer := admin.NewServer(&routes, &workers, indexTemplate, notFoundTemplate, autocomplete, db)
-
 	port := flag.Int("port", defaultPort, "main port used for access")
-	routerServer := router.NewServer(&routes)
+	tlsPort := flag.Int("tls-port", defaultTLSPort,
+		"port used for access over https with certificates uploaded via admin api, 0 disables it")
+	http3Port := flag.Int("http3-port", defaultHTTP3Port,
+		"udp port used for access over http/3 with the same certificates as the tls port, 0 disables it")
+	altSvcPort := flag.Int("alt-svc-port", 0,
+		"udp port of http/3 advertised to clients, 0 uses the http3 port; set it when clients reach the http3 port via another one")
+	httpsPort := flag.Int("https-port", 0,
+		"port of urls in redirects to https, 0 uses the tls port; set it when clients reach the tls port via another one")
+	upgradeIdleTimeout := flag.Duration("upgrade-idle-timeout", defaultUpgradeIdleTimeout,
+		"close upgraded (e.g. WebSocket) connections without traffic for this long, 0 disables the timeout")
+	retryBudget := flag.Float64("retry-budget", defaultRetryBudget,
+		"share of requests of all routes that can be retried over the last 10 seconds")
+	retryBudgetMin := flag.Int("retry-budget-min", defaultRetryBudgetMin,
+		"retries per second allowed regardless of the retry budget")
+	retryBufferSize := flag.Int64("retry-buffer-size", defaultRetryBufferSize,
+		"largest request body in bytes buffered for retries, requests with larger bodies aren't retried")
+	readHeaderTimeout := flag.Duration("read-header-timeout", defaultReadHeaderTimeout,
+		"time to read request headers from clients, 0 disables the timeout")
+	readTimeout := flag.Duration("read-timeout", defaultReadTimeout,
+		"time to read whole requests including bodies from clients, 0 disables the timeout")
+	writeTimeout := flag.Duration("write-timeout", 0,
+		"time to write responses to clients, 0 disables the timeout; it also cuts long streaming responses")
+	idleTimeout := flag.Duration("idle-timeout", defaultIdleTimeout,
+		"time to keep idle keep-alive connections of clients, 0 uses the read timeout")
+	acmeDirectory := flag.String("acme-directory", "",
+		"ACME directory url used to obtain certificates for routes requesting them "+
+			"(e.g. https://acme-v02.api.letsencrypt.org/directory), empty disables ACME")
+	acmeEmail := flag.String("acme-email", "", "contact email of the ACME account")
+	acmeCA := flag.String("acme-ca", "",
+		"PEM file with CA certificates verifying the ACME directory instead of system roots (e.g. the root of Pebble)")
+	acmeRenewBefore := flag.Duration("acme-renew-before", defaultACMERenewBefore,
+		"renew ACME certificates this long before they expire")
+
+	flag.Parse()
+
+	if *httpsPort == 0 {
+		*httpsPort = *tlsPort
+	}
+
+	if *altSvcPort == 0 || *http3Port == 0 {
+		*altSvcPort = *http3Port
+	}
+
+	stats := metrics.New()
+	streams := stream.NewManager(&routes, &workers)
+
+	adminServer := admin.NewServer(&routes, &certificates, &workers, indexTemplate, notFoundTemplate, autocomplete, db,
+		stats, streams, []int{*adminPort, *port, *tlsPort, *http3Port})
+	var manager *acme.Manager
+
+	if *acmeDirectory != "" {
+		manager, err = setupACME(db, &workers, acme.Config{
+			DirectoryURL: *acmeDirectory,
+			Email:        *acmeEmail,
+			CA:           nil,
+			RenewBefore:  *acmeRenewBefore,
+		}, *acmeCA)
+		if err != nil {
+			log.Printf("error setting up acme: %v", err)
+
+			return
+		}
+	}
+
+	routerServer := router.NewServer(&routes, &certificates, manager, stats, router.Config{
+		UpgradeIdleTimeout: *upgradeIdleTimeout,
+		RetryBudget:        *retryBudget,
+		RetryBudgetMin:     *retryBudgetMin,
+		RetryBufferSize:    *retryBufferSize,
+		ReadHeaderTimeout:  *readHeaderTimeout,
+		ReadTimeout:        *readTimeout,
+		WriteTimeout:       *writeTimeout,
+		IdleTimeout:        *idleTimeout,
+		HTTPSPort:          *httpsPort,
+		HTTP3Port:          *altSvcPort,
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -84,6 +180,42 @@ func main() {
 	go adminServer.ListenAndServe(ctx, *adminPort)
 	go routerServer.ListenAndServe(ctx, *port)
 
+	if *tlsPort != 0 {
+		go routerServer.ListenAndServeTLS(ctx, *tlsPort)
+	}
+
+	if *http3Port != 0 {
+		go routerServer.ListenAndServeHTTP3(ctx, *http3Port)
+	}
+
+	checker := health.NewChecker(&routes, &certificates, &workers)
+
+	workers.Add(1)
+
+	go func() {
+		defer workers.Done()
+
+		checker.Run(ctx)
+	}()
+
+	workers.Add(1)
+
+	go func() {
+		defer workers.Done()
+
+		streams.Run(ctx)
+	}()
+
+	if manager != nil {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			manager.Run(ctx)
+		}()
+	}
+
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
 
@@ -101,29 +233,70 @@ func setupDB() (*gorm.DB, error) {
 	}
 
 	if err := db.AutoMigrate(
-		&models.Route{}, //nolint:exhaustivestruct
+		&models.Route{},       //nolint:exhaustivestruct
+		&models.Predicate{},   //nolint:exhaustivestruct
+		&models.Target{},      //nolint:exhaustivestruct
+		&models.Certificate{}, //nolint:exhaustivestruct
+		&models.ACMEEntry{},   //nolint:exhaustivestruct
 	); err != nil {
 		return nil, fmt.Errorf("error running migrations: %w", err)
 	}
 
+	populateCertificates(db)
 	populateRoutes(db)
 
 	return db, nil
 }
 
+func setupACME(db *gorm.DB, workers *sync.WaitGroup, config acme.Config, caFile string) (*acme.Manager, error) {
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading acme ca: %w", err)
+		}
+
+		config.CA = ca
+	}
+
+	manager, err := acme.NewManager(&routes, workers, db, config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating acme manager: %w", err)
+	}
+
+	return manager, nil
+}
+
+func populateCertificates(db *gorm.DB) {
+	var storedCertificates []models.Certificate
+
+	if err := db.Order("id").Find(&storedCertificates).Error; err != nil {
+		log.Fatalf("error reading stored certificates from db: %v", err)
+	}
+
+	certificates = certs.New()
+
+	for _, certificate := range storedCertificates {
+		parsed, err := certs.Parse(certificate)
+		if err != nil {
+			log.Printf("certificate %d is skipped: %v", certificate.ID, err)
+
+			continue
+		}
+
+		certificates.Set(parsed)
+	}
+}
+
 func populateRoutes(db *gorm.DB) {
 	var storedRoutes []models.Route
 
-	if err := db.Order("id DESC").Find(&storedRoutes).Error; err != nil {
+	if err := db.Preload("Predicates").Preload("Targets").Order("id").Find(&storedRoutes).Error; err != nil {
 		log.Fatalf("error reading stored routes from db: %v", err)
 	}
 
 	routes = routing.New()
 
 	for _, route := range storedRoutes {
-		routes.Set(route.From, routing.RouteInfo{
-			To:   route.To,
-			Type: route.Type,
-		})
+		routes.Set(routing.NewRouteInfo(route))
 	}
 }
@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iskorotkov/router/internal/models"
+	"golang.org/x/crypto/acme/autocert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cache keeps the account and certificates of the ACME client in the database, so they survive restarts.
+type Cache struct {
+	db *gorm.DB
+}
+
+var _ autocert.Cache = Cache{} //nolint:exhaustivestruct
+
+func NewCache(db *gorm.DB) Cache {
+	return Cache{db: db}
+}
+
+func (c Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	var entry models.ACMEEntry
+
+	// Misses are expected, so they aren't reported as errors of the query.
+	result := c.db.WithContext(ctx).Limit(1).Find(&entry, models.ACMEEntry{Key: key}) //nolint:exhaustivestruct
+	if result.Error != nil {
+		return nil, fmt.Errorf("error reading acme entry %q: %w", key, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return entry.Data, nil
+}
+
+func (c Cache) Put(ctx context.Context, key string, data []byte) error {
+	entry := models.ACMEEntry{Key: key, Data: data} //nolint:exhaustivestruct
+
+	if err := c.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error; err != nil { //nolint:exhaustivestruct,lll
+		return fmt.Errorf("error saving acme entry %q: %w", key, err)
+	}
+
+	return nil
+}
+
+func (c Cache) Delete(ctx context.Context, key string) error {
+	if err := c.db.WithContext(ctx).Delete(&models.ACMEEntry{Key: key}).Error; err != nil { //nolint:exhaustivestruct
+		return fmt.Errorf("error deleting acme entry %q: %w", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package acme
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "db.sqlite")))
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.ACMEEntry{})) //nolint:exhaustivestruct
+
+	ctx := context.Background()
+	cache := NewCache(db)
+
+	_, err = cache.Get(ctx, "acme_account+key")
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte("first")))
+	assert.NoError(t, cache.Put(ctx, "example.com", []byte("certificate")))
+
+	data, err := cache.Get(ctx, "acme_account+key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first"), data)
+
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte("second")))
+
+	data, err = cache.Get(ctx, "acme_account+key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("second"), data)
+
+	assert.NoError(t, cache.Delete(ctx, "acme_account+key"))
+	assert.NoError(t, cache.Delete(ctx, "missing"))
+
+	_, err = cache.Get(ctx, "acme_account+key")
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+
+	data, err = cache.Get(ctx, "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("certificate"), data)
+}
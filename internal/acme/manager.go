@@ -0,0 +1,271 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"gorm.io/gorm"
+)
+
+const (
+	// resolution is how often the manager looks for routes without certificates.
+	resolution = time.Minute
+	// retryDelay is how long the manager waits before obtaining a certificate again after a failure.
+	retryDelay = 10 * time.Minute
+	// challengePrefix is the path of HTTP-01 challenges.
+	challengePrefix = "/.well-known/acme-challenge/"
+)
+
+var (
+	ErrHostNotAllowed = fmt.Errorf("no route requests a certificate for the host")
+	ErrInvalidCA      = fmt.Errorf("no certificates in CA bundle")
+)
+
+// Config contains settings of the ACME client.
+type Config struct {
+	// DirectoryURL is the directory of the certificate authority, e.g. of Let's Encrypt or of a local Pebble instance.
+	DirectoryURL string
+	// Email is the contact of the account, it can be empty.
+	Email string
+	// CA is a PEM bundle verifying the directory instead of system roots, e.g. the root of Pebble.
+	CA []byte
+	// RenewBefore is how long before expiration certificates are renewed, zero means 30 days.
+	RenewBefore time.Duration
+}
+
+// Manager obtains certificates for hosts of routes requesting them and renews them in the background.
+// Challenges are answered by the router itself: TLS-ALPN-01 through GetCertificate and HTTP-01 through HTTPHandler.
+type Manager struct {
+	routes     *routing.Cache
+	workers    *sync.WaitGroup
+	manager    *autocert.Manager
+	challenges http.Handler
+	// next is when a certificate for a host is obtained again, zero for hosts that already have one.
+	next    map[string]time.Time
+	results chan result
+}
+
+type result struct {
+	host string
+	err  error
+}
+
+func NewManager(routes *routing.Cache, workers *sync.WaitGroup, db *gorm.DB, config Config) (*Manager, error) {
+	var transport http.RoundTripper = http.DefaultTransport
+
+	if len(config.CA) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CA) {
+			return nil, ErrInvalidCA
+		}
+
+		transport = &http.Transport{ //nolint:exhaustivestruct
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, //nolint:exhaustivestruct
+		}
+	}
+
+	client := &acme.Client{ //nolint:exhaustivestruct
+		DirectoryURL: config.DirectoryURL,
+		HTTPClient:   &http.Client{Transport: newLocationTransport(transport)}, //nolint:exhaustivestruct
+	}
+
+	m := &Manager{
+		routes:     routes,
+		workers:    workers,
+		manager:    nil,
+		challenges: nil,
+		next:       make(map[string]time.Time),
+		results:    make(chan result),
+	}
+
+	m.manager = &autocert.Manager{ //nolint:exhaustivestruct
+		Prompt:      autocert.AcceptTOS,
+		Cache:       NewCache(db),
+		HostPolicy:  m.hostPolicy,
+		RenewBefore: config.RenewBefore,
+		Client:      client,
+		Email:       config.Email,
+	}
+
+	// HTTP-01 is enabled before any certificate is requested, otherwise only TLS-ALPN-01 would be used.
+	m.challenges = m.manager.HTTPHandler(http.NotFoundHandler())
+
+	return m, nil
+}
+
+// GetCertificate returns a certificate for a host of a route, obtaining it if there is none yet,
+// or a certificate answering a TLS-ALPN-01 challenge.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := m.manager.GetCertificate(hello)
+	if err != nil {
+		return nil, fmt.Errorf("error getting acme certificate for %q: %w", hello.ServerName, err)
+	}
+
+	return cert, nil
+}
+
+// HTTPHandler answers HTTP-01 challenges for hosts of routes requesting certificates and passes other requests
+// to the fallback, so targets of other routes can answer their own challenges.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if IsChallengePath(r.URL.Path) && m.Allowed(r.Host) {
+			m.challenges.ServeHTTP(rw, r)
+
+			return
+		}
+
+		fallback.ServeHTTP(rw, r)
+	})
+}
+
+// Allowed reports whether a route requests a certificate for the host.
+func (m *Manager) Allowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(stripPort(host), "."))
+
+	for _, h := range Hosts(m.routes) {
+		if h == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) hostPolicy(_ context.Context, host string) error {
+	if !m.Allowed(host) {
+		return fmt.Errorf("%q: %w", host, ErrHostNotAllowed)
+	}
+
+	return nil
+}
+
+// Run obtains certificates for new routes until the context is canceled, so the first client of a route
+// doesn't wait for the certificate. Certificates stored in the database are loaded the same way,
+// which also schedules their renewal.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	m.schedule(ctx, time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.schedule(ctx, now)
+		case res := <-m.results:
+			m.record(res)
+		}
+	}
+}
+
+// schedule starts obtaining certificates for hosts that are due and forgets hosts of removed routes.
+func (m *Manager) schedule(ctx context.Context, now time.Time) {
+	seen := make(map[string]bool)
+
+	for _, host := range Hosts(m.routes) {
+		seen[host] = true
+
+		next, ok := m.next[host]
+		if ok && (next.IsZero() || now.Before(next)) {
+			continue
+		}
+
+		// Hosts aren't obtained twice at the same time, the result sets the real time.
+		m.next[host] = now.Add(retryDelay)
+
+		m.workers.Add(1)
+
+		go func(host string) {
+			defer m.workers.Done()
+
+			_, err := m.GetCertificate(helloFor(host))
+
+			select {
+			case m.results <- result{host: host, err: err}:
+			case <-ctx.Done():
+			}
+		}(host)
+	}
+
+	for host := range m.next {
+		if !seen[host] {
+			delete(m.next, host)
+		}
+	}
+}
+
+func (m *Manager) record(res result) {
+	if _, ok := m.next[res.host]; !ok {
+		return
+	}
+
+	if res.err != nil {
+		log.Printf("error obtaining certificate for %q, retrying in %v: %v", res.host, retryDelay, res.err)
+
+		return
+	}
+
+	log.Printf("certificate for %q is ready", res.host)
+
+	m.next[res.host] = time.Time{}
+}
+
+// Hosts returns hosts of routes requesting certificates.
+// Only exact host routes can request them, because wildcard names need DNS challenges.
+func Hosts(routes *routing.Cache) []string {
+	var hosts []string
+
+	for _, info := range routes.GetAll() {
+		if !info.ACME || info.Mode != models.RouteModeHost || info.FromMatch != models.FromMatchExact {
+			continue
+		}
+
+		hosts = append(hosts, strings.ToLower(stripPort(info.From)))
+	}
+
+	return hosts
+}
+
+// IsChallenge reports whether the handshake is made by a certificate authority verifying a TLS-ALPN-01 challenge.
+func IsChallenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto
+}
+
+// IsChallengePath reports whether the path is requested by a certificate authority verifying an HTTP-01 challenge.
+func IsChallengePath(path string) bool {
+	return strings.HasPrefix(path, challengePrefix)
+}
+
+// helloFor builds a handshake of a client supporting ECDSA, so certificates obtained in advance
+// are the ones modern clients get.
+func helloFor(host string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{ //nolint:exhaustivestruct
+		ServerName:       host,
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		SupportedCurves:  []tls.CurveID{tls.CurveP256},
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+	}
+}
+
+func stripPort(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
+	}
+
+	return host
+}
@@ -0,0 +1,118 @@
+package acme
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestManager_Allowed(t *testing.T) {
+	t.Parallel()
+
+	routes := routing.New()
+
+	for i, route := range []models.Route{
+		{From: "example.com", Mode: models.RouteModeHost, ACME: true},                                        //nolint:exhaustivestruct
+		{From: "Upper.example.com:8443", Mode: models.RouteModeHost, ACME: true},                             //nolint:exhaustivestruct
+		{From: "plain.example.com", Mode: models.RouteModeHost},                                              //nolint:exhaustivestruct
+		{From: "source.example.com", Mode: models.RouteModeSource, ACME: true},                               //nolint:exhaustivestruct
+		{From: "*.example.com", Mode: models.RouteModeHost, FromMatch: models.FromMatchWildcard, ACME: true}, //nolint:exhaustivestruct,lll
+	} {
+		route.Model = gorm.Model{ID: uint(i + 1)} //nolint:exhaustivestruct
+		routes.Set(routing.NewRouteInfo(route))
+	}
+
+	m := &Manager{routes: &routes} //nolint:exhaustivestruct
+
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{name: "exact host", host: "example.com", want: true},
+		{name: "host with port", host: "example.com:443", want: true},
+		{name: "trailing dot", host: "example.com.", want: true},
+		{name: "route with port", host: "upper.example.com", want: true},
+		{name: "case insensitive", host: "UPPER.example.com", want: true},
+		{name: "route without acme", host: "plain.example.com", want: false},
+		{name: "source route", host: "source.example.com", want: false},
+		{name: "wildcard route", host: "sub.example.com", want: false},
+		{name: "unknown host", host: "other.com", want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, m.Allowed(tt.host))
+		})
+	}
+}
+
+func TestManager_HTTPHandler(t *testing.T) {
+	t.Parallel()
+
+	routes := routing.New()
+	routes.Set(routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+		Model: gorm.Model{ID: 1}, //nolint:exhaustivestruct
+		From:  "example.com",
+		Mode:  models.RouteModeHost,
+		ACME:  true,
+	}))
+
+	m := &Manager{ //nolint:exhaustivestruct
+		routes: &routes,
+		challenges: http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusTeapot)
+		}),
+	}
+
+	const challenge = "/.well-known/acme-challenge/token"
+
+	handler := m.HTTPHandler(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name string
+		host string
+		path string
+		want int
+	}{
+		{name: "challenge of acme host", host: "example.com", path: challenge, want: http.StatusTeapot},
+		{name: "challenge of other host", host: "other.com", path: challenge, want: http.StatusNoContent},
+		{name: "other path of acme host", host: "example.com", path: "/", want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Host = tt.host
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, r)
+
+			assert.Equal(t, tt.want, rw.Code)
+		})
+	}
+}
+
+func TestIsChallenge(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, IsChallenge(&tls.ClientHelloInfo{SupportedProtos: []string{"acme-tls/1"}}))        //nolint:exhaustivestruct
+	assert.False(t, IsChallenge(&tls.ClientHelloInfo{SupportedProtos: []string{"h2", "acme-tls/1"}})) //nolint:exhaustivestruct
+	assert.False(t, IsChallenge(&tls.ClientHelloInfo{}))                                              //nolint:exhaustivestruct
+}
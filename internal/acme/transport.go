@@ -0,0 +1,70 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// locationTransport adds the URL of the order to responses to finalize requests that don't have it.
+// RFC 8555 doesn't require the Location header there and Pebble doesn't send it, but the ACME client
+// uses it to wait for certificates issued asynchronously.
+type locationTransport struct {
+	next http.RoundTripper
+	// orders maps finalize URLs of orders in progress to their URLs.
+	orders map[string]string
+	m      sync.Mutex
+}
+
+func newLocationTransport(next http.RoundTripper) *locationTransport {
+	return &locationTransport{
+		next:   next,
+		orders: make(map[string]string),
+		m:      sync.Mutex{},
+	}
+}
+
+func (t *locationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost {
+		return resp, err //nolint:wrapcheck
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		t.m.Lock()
+		defer t.m.Unlock()
+
+		if order, ok := t.orders[req.URL.String()]; ok {
+			resp.Header.Set("Location", order)
+			delete(t.orders, req.URL.String())
+		}
+
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading acme response: %w", err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var order struct {
+		Finalize string `json:"finalize"`
+	}
+
+	// Only orders have the finalize URL, other responses are passed as is.
+	if json.Unmarshal(body, &order) == nil && order.Finalize != "" {
+		t.m.Lock()
+		t.orders[order.Finalize] = location
+		t.m.Unlock()
+	}
+
+	return resp, nil
+}
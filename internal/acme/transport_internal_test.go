@@ -0,0 +1,57 @@
+package acme
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocationTransport(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/new-order":
+			rw.Header().Set("Location", server.URL+"/order/1")
+			rw.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(rw, `{"status": "pending", "finalize": %q}`, server.URL+"/finalize/1")
+		case "/finalize/1":
+			_, _ = fmt.Fprint(rw, `{"status": "processing"}`)
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newLocationTransport(http.DefaultTransport)} //nolint:exhaustivestruct
+
+	resp, err := client.Post(server.URL+"/new-order", "application/jose+json", nil) //nolint:noctx
+	assert.NoError(t, err)
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(body), "finalize"), "body of the order is passed as is")
+
+	resp, err = client.Post(server.URL+"/finalize/1", "application/jose+json", nil) //nolint:noctx
+	assert.NoError(t, err)
+
+	_ = resp.Body.Close()
+
+	assert.Equal(t, server.URL+"/order/1", resp.Header.Get("Location"))
+
+	resp, err = client.Post(server.URL+"/finalize/1", "application/jose+json", nil) //nolint:noctx
+	assert.NoError(t, err)
+
+	_ = resp.Body.Close()
+
+	assert.Empty(t, resp.Header.Get("Location"), "locations are added once")
+}
@@ -0,0 +1,231 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/iskorotkov/router/internal/certs"
+	"github.com/iskorotkov/router/internal/models"
+	"gorm.io/gorm"
+)
+
+// createCertificateDTO contains a PEM encoded certificate chain and an optional key.
+// Certificates without a key can only be used as CA bundles.
+type createCertificateDTO struct {
+	Name        string `json:"name"`
+	Certificate string `json:"certificate"`
+	Key         string `json:"key"`
+}
+
+func (c *createCertificateDTO) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+
+	if c.Name == "" || strings.TrimSpace(c.Certificate) == "" {
+		return fmt.Errorf("name or certificate is empty: %w", ErrValidation)
+	}
+
+	return nil
+}
+
+// deleteCertificateDTO selects a certificate by its id.
+type deleteCertificateDTO struct {
+	ID uint `json:"id"`
+}
+
+// upstreamTLSDTO configures TLS connections to targets, see models.UpstreamTLS.
+type upstreamTLSDTO struct {
+	Scheme             string `json:"scheme"`
+	CA                 string `json:"ca"`
+	ClientCertificate  string `json:"clientCertificate"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+func (c *createRouteDTO) validateUpstreamTLS() error {
+	settings := &c.UpstreamTLS
+	settings.CA = strings.TrimSpace(settings.CA)
+	settings.ClientCertificate = strings.TrimSpace(settings.ClientCertificate)
+	settings.ServerName = strings.TrimSpace(settings.ServerName)
+
+	if *settings == (upstreamTLSDTO{}) { //nolint:exhaustivestruct
+		return nil
+	}
+
+	if c.Type != models.RouteTypeProxy {
+		return fmt.Errorf("upstream tls of %v is set for a non-proxy route: %w", c, ErrValidation)
+	}
+
+	if settings.Scheme != "" && settings.Scheme != "http" && settings.Scheme != "https" {
+		return fmt.Errorf("upstream scheme of %v is invalid: %w", c, ErrValidation)
+	}
+
+	return nil
+}
+
+// validateACME checks that a certificate is requested for a domain name of an exact host route,
+// certificate authorities don't issue certificates for patterns without DNS challenges or for addresses.
+func (c *createRouteDTO) validateACME() error {
+	if !c.ACME {
+		return nil
+	}
+
+	if c.Mode != models.RouteModeHost || c.FromMatch != models.FromMatchExact {
+		return fmt.Errorf("acme certificate of %v requires %q mode and %q match: %w",
+			c, models.RouteModeHost, models.FromMatchExact, ErrValidation)
+	}
+
+	host := c.From
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	if net.ParseIP(host) != nil || !strings.Contains(strings.Trim(host, "."), ".") {
+		return fmt.Errorf("acme certificate of %v requires a domain name: %w", c, ErrValidation)
+	}
+
+	return nil
+}
+
+// validateCertificates checks that certificates used by the route exist.
+func (u upstreamTLSDTO) validateCertificates(certificates *certs.Store) error {
+	if _, err := certificates.ClientConfig(u.toModel()); err != nil {
+		return fmt.Errorf("upstream tls is invalid: %v: %w", err, ErrValidation)
+	}
+
+	return nil
+}
+
+func (u upstreamTLSDTO) toModel() models.UpstreamTLS {
+	return models.UpstreamTLS{
+		Scheme:             u.Scheme,
+		CA:                 u.CA,
+		ClientCertificate:  u.ClientCertificate,
+		ServerName:         u.ServerName,
+		InsecureSkipVerify: u.InsecureSkipVerify,
+	}
+}
+
+func (s Server) listCertificates(rw http.ResponseWriter, _ *http.Request) {
+	writeJSON(rw, http.StatusOK, s.certificates.GetAll())
+}
+
+func (s Server) createCertificate(rw http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("error reading certificate from request body: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	var certificate createCertificateDTO
+
+	err = json.Unmarshal(b, &certificate)
+	if err != nil {
+		log.Printf("error unmarshaling certificate from request body: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	if err := certificate.Validate(); err != nil {
+		log.Printf("error validating dto: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	if _, ok := s.certificates.GetByName(certificate.Name); ok {
+		log.Printf("certificate %q already exists", certificate.Name)
+		http.Error(rw, "", http.StatusConflict)
+
+		return
+	}
+
+	model := models.Certificate{
+		Model:       gorm.Model{}, //nolint:exhaustivestruct
+		Name:        certificate.Name,
+		Certificate: certificate.Certificate,
+		Key:         certificate.Key,
+	}
+
+	parsed, err := certs.Parse(model)
+	if err != nil {
+		log.Printf("error parsing certificate: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	// The certificate is saved synchronously because its id is used as a key in the store.
+	if err := s.db.Create(&model).Error; err != nil {
+		log.Printf("error saving certificate to db: %v", err)
+		http.Error(rw, "", http.StatusInternalServerError)
+
+		return
+	}
+
+	log.Printf("certificate saved to db")
+
+	parsed.ID = model.ID
+	s.certificates.Set(parsed)
+
+	writeJSON(rw, http.StatusCreated, parsed)
+}
+
+func (s Server) deleteCertificate(rw http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("error reading certificate from request body: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	var certificate deleteCertificateDTO
+
+	err = json.Unmarshal(b, &certificate)
+	if err != nil {
+		log.Printf("error unmarshaling certificate from request body: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	existing, ok := s.certificates.Get(certificate.ID)
+	if !ok {
+		api404(rw, r)
+
+		return
+	}
+
+	for _, info := range s.routes.GetAll() {
+		if info.UpstreamTLS.CA == existing.Name || info.UpstreamTLS.ClientCertificate == existing.Name {
+			log.Printf("certificate %q is used by route %d", existing.Name, info.ID)
+			http.Error(rw, "", http.StatusConflict)
+
+			return
+		}
+	}
+
+	s.certificates.Remove(existing.ID)
+
+	s.workers.Add(1)
+
+	go func() {
+		defer s.workers.Done()
+
+		if err := s.db.Delete(&models.Certificate{}, existing.ID).Error; err != nil { //nolint:exhaustivestruct
+			log.Printf("error deleting certificate from db: %v", err)
+
+			return
+		}
+
+		log.Printf("certificate deleted from db")
+	}()
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+// minHealthCheckInterval is the resolution of the health checker.
+const minHealthCheckInterval = models.Duration(time.Second)
+
+// healthCheckDTO configures health checks of route targets, zero values are replaced with defaults.
+type healthCheckDTO struct {
+	Type               models.HealthCheckType `json:"type"`
+	Path               string                 `json:"path"`
+	Interval           models.Duration        `json:"interval"`
+	Timeout            models.Duration        `json:"timeout"`
+	HealthyThreshold   int                    `json:"healthyThreshold"`
+	UnhealthyThreshold int                    `json:"unhealthyThreshold"`
+}
+
+func (c *createRouteDTO) validateHealthCheck() error {
+	check := &c.HealthCheck
+	check.Path = strings.TrimSpace(check.Path)
+
+	switch check.Type {
+	case "":
+		if *check != (healthCheckDTO{}) { //nolint:exhaustivestruct
+			return fmt.Errorf("health check of %v has settings but no type: %w", c, ErrValidation)
+		}
+
+		return nil
+	case models.HealthCheckHTTP:
+		if check.Path != "" && !strings.HasPrefix(check.Path, "/") {
+			return fmt.Errorf("health check path of %v must start with '/': %w", c, ErrValidation)
+		}
+	case models.HealthCheckTCP:
+		if check.Path != "" {
+			return fmt.Errorf("health check path of %v is set for a tcp check: %w", c, ErrValidation)
+		}
+	default:
+		return fmt.Errorf("health check type of %v is invalid: %w", c, ErrValidation)
+	}
+
+	if c.Type != models.RouteTypeProxy && c.Type != models.RouteTypeTCP {
+		return fmt.Errorf("health check of %v is set for a non-proxy route: %w", c, ErrValidation)
+	}
+
+	if c.Type == models.RouteTypeTCP && check.Type != models.HealthCheckTCP {
+		return fmt.Errorf("health check of tcp route %v must be a %q check: %w", c, models.HealthCheckTCP, ErrValidation)
+	}
+
+	if check.Interval != 0 && check.Interval < minHealthCheckInterval {
+		return fmt.Errorf("health check interval of %v is shorter than %v: %w", c, minHealthCheckInterval, ErrValidation)
+	}
+
+	if check.Timeout < 0 || check.Interval != 0 && check.Timeout > check.Interval {
+		return fmt.Errorf("health check timeout of %v must be positive and not longer than the interval: %w",
+			c, ErrValidation)
+	}
+
+	if check.HealthyThreshold < 0 || check.UnhealthyThreshold < 0 {
+		return fmt.Errorf("health check thresholds of %v are negative: %w", c, ErrValidation)
+	}
+
+	return nil
+}
+
+func (h healthCheckDTO) toModel() models.HealthCheck {
+	return models.HealthCheck{
+		Type:               h.Type,
+		Path:               h.Path,
+		Interval:           h.Interval,
+		Timeout:            h.Timeout,
+		HealthyThreshold:   h.HealthyThreshold,
+		UnhealthyThreshold: h.UnhealthyThreshold,
+	}
+}
+
+// circuitBreakerDTO configures ejection of failing route targets, zero durations are replaced with defaults.
+type circuitBreakerDTO struct {
+	Failures    int             `json:"failures"`
+	Ejection    models.Duration `json:"ejection"`
+	MaxEjection models.Duration `json:"maxEjection"`
+}
+
+func (c *createRouteDTO) validateCircuitBreaker() error {
+	breaker := c.CircuitBreaker
+
+	if breaker.Failures == 0 {
+		if breaker != (circuitBreakerDTO{}) { //nolint:exhaustivestruct
+			return fmt.Errorf("circuit breaker of %v has settings but no failures threshold: %w", c, ErrValidation)
+		}
+
+		return nil
+	}
+
+	if c.Type != models.RouteTypeProxy && c.Type != models.RouteTypeTCP {
+		return fmt.Errorf("circuit breaker of %v is set for a non-proxy route: %w", c, ErrValidation)
+	}
+
+	if breaker.Failures < 0 || breaker.Ejection < 0 || breaker.MaxEjection < 0 {
+		return fmt.Errorf("circuit breaker settings of %v are negative: %w", c, ErrValidation)
+	}
+
+	if breaker.Ejection != 0 && breaker.MaxEjection != 0 && breaker.MaxEjection < breaker.Ejection {
+		return fmt.Errorf("max ejection of %v is shorter than the ejection: %w", c, ErrValidation)
+	}
+
+	return nil
+}
+
+func (c circuitBreakerDTO) toModel() models.CircuitBreaker {
+	return models.CircuitBreaker{
+		Failures:    c.Failures,
+		Ejection:    c.Ejection,
+		MaxEjection: c.MaxEjection,
+	}
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+// hstsPreloadMaxAge is the shortest max-age browsers accept for preloading.
+const hstsPreloadMaxAge = models.Duration(365 * 24 * time.Hour)
+
+// httpsDTO redirects plain HTTP requests to HTTPS and sets Strict-Transport-Security, see models.HTTPS.
+type httpsDTO struct {
+	Redirect              bool            `json:"redirect"`
+	HSTSMaxAge            models.Duration `json:"hstsMaxAge"`
+	HSTSIncludeSubdomains bool            `json:"hstsIncludeSubdomains"`
+	HSTSPreload           bool            `json:"hstsPreload"`
+}
+
+func (c *createRouteDTO) validateHTTPS() error {
+	settings := c.HTTPS
+
+	if settings.HSTSMaxAge < 0 {
+		return fmt.Errorf("hsts max age of %v is negative: %w", c, ErrValidation)
+	}
+
+	if settings.HSTSMaxAge == 0 && (settings.HSTSIncludeSubdomains || settings.HSTSPreload) {
+		return fmt.Errorf("hsts directives of %v are set without max age: %w", c, ErrValidation)
+	}
+
+	if settings.HSTSPreload && (!settings.HSTSIncludeSubdomains || settings.HSTSMaxAge < hstsPreloadMaxAge) {
+		return fmt.Errorf("hsts preload of %v requires subdomains and max age of at least %v: %w",
+			c, hstsPreloadMaxAge, ErrValidation)
+	}
+
+	return nil
+}
+
+func (h httpsDTO) toModel() models.HTTPS {
+	return models.HTTPS{
+		Redirect:              h.Redirect,
+		HSTSMaxAge:            h.HSTSMaxAge,
+		HSTSIncludeSubdomains: h.HSTSIncludeSubdomains,
+		HSTSPreload:           h.HSTSPreload,
+	}
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"fmt"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+// poolDTO tunes connections to each target of a route, zero values are replaced with defaults.
+type poolDTO struct {
+	MaxIdleConns    int             `json:"maxIdleConns"`
+	MaxConnsPerHost int             `json:"maxConnsPerHost"`
+	IdleTimeout     models.Duration `json:"idleTimeout"`
+	KeepAlive       models.Duration `json:"keepAlive"`
+	DisableHTTP2    bool            `json:"disableHttp2"`
+	H2C             bool            `json:"h2c"`
+}
+
+func (c *createRouteDTO) validatePool() error {
+	pool := c.Pool
+
+	if pool == (poolDTO{}) { //nolint:exhaustivestruct
+		return nil
+	}
+
+	if c.Type != models.RouteTypeProxy {
+		return fmt.Errorf("connection pool of %v is set for a non-proxy route: %w", c, ErrValidation)
+	}
+
+	// Negative keep-alive disables keep-alive probes.
+	if pool.MaxIdleConns < 0 || pool.MaxConnsPerHost < 0 || pool.IdleTimeout < 0 {
+		return fmt.Errorf("connection pool settings of %v are negative: %w", c, ErrValidation)
+	}
+
+	if pool.H2C && (pool.DisableHTTP2 || c.UpstreamTLS.Scheme == "https") {
+		return fmt.Errorf("h2c of %v is set with disabled http/2 or with tls: %w", c, ErrValidation)
+	}
+
+	// HTTP/2 opens connections as streams are needed and keeps idle ones on its own.
+	if pool.H2C && (pool.MaxConnsPerHost != 0 || pool.MaxIdleConns != 0) {
+		return fmt.Errorf("connection limits of %v can't be set for h2c targets: %w", c, ErrValidation)
+	}
+
+	return nil
+}
+
+func (p poolDTO) toModel() models.Pool {
+	return models.Pool{
+		MaxIdleConns:    p.MaxIdleConns,
+		MaxConnsPerHost: p.MaxConnsPerHost,
+		IdleTimeout:     p.IdleTimeout,
+		KeepAlive:       p.KeepAlive,
+		DisableHTTP2:    p.DisableHTTP2,
+		H2C:             p.H2C,
+	}
+}
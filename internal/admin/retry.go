@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+// retryDTO configures retries of failed requests, see models.Retry.
+// Empty lists of statuses and errors retry 502, 503, 504 and all errors, zero durations are replaced with defaults.
+type retryDTO struct {
+	Attempts      int                 `json:"attempts"`
+	Statuses      []int               `json:"statuses"`
+	Errors        []models.RetryError `json:"errors"`
+	Backoff       models.Duration     `json:"backoff"`
+	MaxBackoff    models.Duration     `json:"maxBackoff"`
+	NonIdempotent bool                `json:"nonIdempotent"`
+}
+
+func (c *createRouteDTO) validateRetry() error {
+	retry := c.Retry
+
+	if retry.Attempts <= 1 {
+		if retry.Attempts < 0 || len(retry.Statuses) != 0 || len(retry.Errors) != 0 ||
+			retry.Backoff != 0 || retry.MaxBackoff != 0 || retry.NonIdempotent {
+			return fmt.Errorf("retry of %v has settings but less than 2 attempts: %w", c, ErrValidation)
+		}
+
+		return nil
+	}
+
+	if c.Type != models.RouteTypeProxy {
+		return fmt.Errorf("retry of %v is set for a non-proxy route: %w", c, ErrValidation)
+	}
+
+	if _, err := routing.ParseRetry(retry.toModel()); err != nil {
+		return fmt.Errorf("retry of %v is invalid: %v: %w", c, err, ErrValidation)
+	}
+
+	return nil
+}
+
+func (r retryDTO) toModel() models.Retry {
+	statuses := make([]string, 0, len(r.Statuses))
+	for _, status := range r.Statuses {
+		statuses = append(statuses, strconv.Itoa(status))
+	}
+
+	kinds := make([]string, 0, len(r.Errors))
+	for _, kind := range r.Errors {
+		kinds = append(kinds, string(kind))
+	}
+
+	return models.Retry{
+		Attempts:      r.Attempts,
+		Statuses:      strings.Join(statuses, ","),
+		Errors:        strings.Join(kinds, ","),
+		Backoff:       r.Backoff,
+		MaxBackoff:    r.MaxBackoff,
+		NonIdempotent: r.NonIdempotent,
+	}
+}
@@ -7,42 +7,69 @@ import (
 	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/iskorotkov/router/internal/certs"
 	"github.com/iskorotkov/router/internal/discover"
+	"github.com/iskorotkov/router/internal/metrics"
 	"github.com/iskorotkov/router/internal/models"
 	"github.com/iskorotkov/router/internal/routing"
+	"github.com/iskorotkov/router/internal/stream"
 	"gorm.io/gorm"
 )
 
+// Timeouts of admin connections, the admin API and the dashboard only serve short requests.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
 var ErrValidation = fmt.Errorf("validation failed")
 
 type Server struct {
 	routes           *routing.Cache
+	certificates     *certs.Store
 	workers          *sync.WaitGroup
 	indexTemplate    *template.Template
 	notFoundTemplate *template.Template
 	autocomplete     discover.Autocomplete
 	db               *gorm.DB
+	metrics          *metrics.Metrics
+	streams          *stream.Manager
+	// ports are used by the router and admin servers, so TCP routes can't listen on them.
+	ports []int
 }
 
+// NewServer creates an admin server, ports are ports of the router and admin servers unavailable to TCP routes.
 func NewServer(
 	routes *routing.Cache,
+	certificates *certs.Store,
 	workers *sync.WaitGroup,
 	indexTemplate *template.Template,
 	notFoundTemplate *template.Template,
 	autocomplete discover.Autocomplete,
 	db *gorm.DB,
+	metrics *metrics.Metrics,
+	streams *stream.Manager,
+	ports []int,
 ) Server {
 	return Server{
 		routes:           routes,
+		certificates:     certificates,
 		workers:          workers,
 		indexTemplate:    indexTemplate,
 		notFoundTemplate: notFoundTemplate,
 		autocomplete:     autocomplete,
 		db:               db,
+		metrics:          metrics,
+		streams:          streams,
+		ports:            ports,
 	}
 }
 
@@ -54,6 +81,8 @@ func (s Server) ListenAndServe(ctx context.Context, port int) {
 			s.listRoutes(rw, r)
 		case http.MethodPost:
 			s.createRoute(rw, r)
+		case http.MethodPatch:
+			s.updateWeights(rw, r)
 		case http.MethodDelete:
 			s.deleteRoute(rw, r)
 		default:
@@ -62,13 +91,61 @@ func (s Server) ListenAndServe(ctx context.Context, port int) {
 			return
 		}
 	})
+	mux.HandleFunc("/api/v1/certificates", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.listCertificates(rw, r)
+		case http.MethodPost:
+			s.createCertificate(rw, r)
+		case http.MethodDelete:
+			s.deleteCertificate(rw, r)
+		default:
+			api404(rw, r)
+
+			return
+		}
+	})
+	mux.HandleFunc("/api/v1/upstreams", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.listUpstreams(rw, r)
+		default:
+			api404(rw, r)
+
+			return
+		}
+	})
+	mux.HandleFunc("/api/v1/metrics", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.showMetrics(rw, r)
+		default:
+			api404(rw, r)
+
+			return
+		}
+	})
+	mux.HandleFunc("/api/v1/streams", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.listStreams(rw, r)
+		default:
+			api404(rw, r)
+
+			return
+		}
+	})
 	mux.Handle("/css/", http.StripPrefix("/css/", http.FileServer(http.Dir("./static/css"))))
 	mux.Handle("/js/", http.StripPrefix("/js/", http.FileServer(http.Dir("./static/js"))))
 	mux.HandleFunc("/", s.showDashboard)
 
 	server := http.Server{ //nolint:exhaustivestruct
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
 	}
 
 	go func() {
@@ -86,30 +163,69 @@ func (s Server) ListenAndServe(ctx context.Context, port int) {
 	}
 }
 
+func (s Server) showMetrics(rw http.ResponseWriter, _ *http.Request) {
+	writeJSON(rw, http.StatusOK, s.metrics.Snapshot())
+}
+
 func (s Server) listRoutes(rw http.ResponseWriter, _ *http.Request) {
-	b, err := json.MarshalIndent(s.routes.GetAll(), "", "  ")
-	if err != nil {
-		log.Printf("error marshaling routes: %v", err)
-		http.Error(rw, "", http.StatusInternalServerError)
+	writeJSON(rw, http.StatusOK, s.routes.GetAll())
+}
 
-		return
-	}
+type createRouteDTO struct {
+	From           string           `json:"from"`
+	FromMatch      models.FromMatch `json:"fromMatch"`
+	To             string           `json:"to"`
+	Type           models.RouteType
+	Mode           models.RouteMode  `json:"mode"`
+	Path           string            `json:"path"`
+	PathMatch      models.PathMatch  `json:"pathMatch"`
+	StripPrefix    bool              `json:"stripPrefix"`
+	Predicates     []predicateDTO    `json:"predicates"`
+	Priority       int               `json:"priority"`
+	QueryMode      models.QueryMode  `json:"queryMode"`
+	RedirectCode   int               `json:"redirectCode"`
+	FlushInterval  models.Duration   `json:"flushInterval"`
+	Targets        []targetDTO       `json:"targets"`
+	Balance        models.Balance    `json:"balance"`
+	BalanceHeader  string            `json:"balanceHeader"`
+	HealthCheck    healthCheckDTO    `json:"healthCheck"`
+	CircuitBreaker circuitBreakerDTO `json:"circuitBreaker"`
+	Retry          retryDTO          `json:"retry"`
+	Timeouts       timeoutsDTO       `json:"timeouts"`
+	Pool           poolDTO           `json:"pool"`
+	UpstreamTLS    upstreamTLSDTO    `json:"upstreamTls"`
+	HTTPS          httpsDTO          `json:"https"`
+	ACME           bool              `json:"acme"`
+	ListenPort     int               `json:"listenPort"`
+}
 
-	rw.Header().Add("Content-Type", http.DetectContentType(b))
-	_, _ = fmt.Fprint(rw, string(b))
+type targetDTO struct {
+	Address string `json:"address"`
+	// Weight defaults to 1, zero adds the target out of rotation.
+	Weight *int `json:"weight"`
 }
 
-type createRouteDTO struct {
-	From string `json:"from"`
-	To   string `json:"to"`
-	Type models.RouteType
+type predicateDTO struct {
+	Kind  models.PredicateKind `json:"kind"`
+	Name  string               `json:"name"`
+	Op    models.PredicateOp   `json:"op"`
+	Value string               `json:"value"`
 }
 
 func (c *createRouteDTO) Validate() error {
 	c.From = strings.TrimSpace(c.From)
 	c.To = strings.TrimSpace(c.To)
+	c.Path = strings.TrimSpace(c.Path)
+
+	if c.Type == models.RouteTypeTCP {
+		return c.validateTCP()
+	}
+
+	if c.ListenPort != 0 {
+		return fmt.Errorf("listen port of %v is set for a non-tcp route: %w", c, ErrValidation)
+	}
 
-	if c.From == "" || c.To == "" {
+	if c.From == "" || c.To == "" && len(c.Targets) == 0 {
 		return fmt.Errorf("one of the fields of %v is empty: %w", c, ErrValidation)
 	}
 
@@ -117,6 +233,258 @@ func (c *createRouteDTO) Validate() error {
 		return fmt.Errorf("route type of %v is invalid: %w", c, ErrValidation)
 	}
 
+	if err := c.validateTargets(); err != nil {
+		return err
+	}
+
+	if c.Mode == "" {
+		c.Mode = models.RouteModeSource
+	}
+
+	if c.Mode != models.RouteModeSource && c.Mode != models.RouteModeHost {
+		return fmt.Errorf("route mode of %v is invalid: %w", c, ErrValidation)
+	}
+
+	if err := c.validateFrom(); err != nil {
+		return err
+	}
+
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("path of %v must start with '/': %w", c, ErrValidation)
+	}
+
+	if c.PathMatch == "" {
+		c.PathMatch = models.PathMatchPrefix
+	}
+
+	if c.PathMatch != models.PathMatchPrefix && c.PathMatch != models.PathMatchExact {
+		return fmt.Errorf("path match of %v is invalid: %w", c, ErrValidation)
+	}
+
+	if err := c.validateRedirectCode(); err != nil {
+		return err
+	}
+
+	if err := c.validateHealthCheck(); err != nil {
+		return err
+	}
+
+	if err := c.validateCircuitBreaker(); err != nil {
+		return err
+	}
+
+	if err := c.validateRetry(); err != nil {
+		return err
+	}
+
+	if err := c.validateTimeouts(); err != nil {
+		return err
+	}
+
+	if err := c.validatePool(); err != nil {
+		return err
+	}
+
+	if err := c.validateUpstreamTLS(); err != nil {
+		return err
+	}
+
+	if err := c.validateHTTPS(); err != nil {
+		return err
+	}
+
+	if err := c.validateACME(); err != nil {
+		return err
+	}
+
+	if c.Type != models.RouteTypeProxy && c.FlushInterval != 0 {
+		return fmt.Errorf("flush interval of %v is set for a non-proxy route: %w", c, ErrValidation)
+	}
+
+	switch c.QueryMode {
+	case "":
+		c.QueryMode = models.QueryModeAppend
+	case models.QueryModeAppend, models.QueryModeReplace, models.QueryModeDrop:
+	default:
+		return fmt.Errorf("query mode of %v is invalid: %w", c, ErrValidation)
+	}
+
+	for i := range c.Predicates {
+		predicate := &c.Predicates[i]
+		predicate.Name = strings.TrimSpace(predicate.Name)
+
+		if predicate.Op == "" {
+			predicate.Op = models.PredicateOpEquals
+		}
+
+		if err := predicate.toInfo().Validate(); err != nil {
+			return fmt.Errorf("predicate %v is invalid: %v: %w", predicate, err, ErrValidation)
+		}
+	}
+
+	return nil
+}
+
+// validateTargets checks that targets are only set for proxy and TCP routes instead of To
+// and sets the default balancing. Weighted targets are split randomly unless another strategy is chosen.
+func (c *createRouteDTO) validateTargets() error {
+	c.BalanceHeader = strings.TrimSpace(c.BalanceHeader)
+
+	if c.Type != models.RouteTypeProxy && c.Type != models.RouteTypeTCP {
+		if len(c.Targets) != 0 || c.Balance != "" || c.BalanceHeader != "" {
+			return fmt.Errorf("targets of %v are set for a non-proxy route: %w", c, ErrValidation)
+		}
+
+		return nil
+	}
+
+	if c.To != "" && len(c.Targets) != 0 {
+		return fmt.Errorf("both target and a list of targets of %v are set: %w", c, ErrValidation)
+	}
+
+	weighted := false
+
+	for i := range c.Targets {
+		target := &c.Targets[i]
+		target.Address = strings.TrimSpace(target.Address)
+
+		if target.Address == "" {
+			return fmt.Errorf("target address of %v is empty: %w", c, ErrValidation)
+		}
+
+		if target.Weight == nil {
+			weight := 1
+			target.Weight = &weight
+		}
+
+		if *target.Weight < 0 {
+			return fmt.Errorf("target weight of %v is negative: %w", c, ErrValidation)
+		}
+
+		weighted = weighted || *target.Weight != *c.Targets[0].Weight
+	}
+
+	switch c.Balance {
+	case "":
+		c.Balance = models.BalanceRoundRobin
+
+		if weighted {
+			c.Balance = models.BalanceRandom
+		}
+	case models.BalanceRoundRobin, models.BalanceRandom, models.BalanceLeastConnections,
+		models.BalanceHashIP, models.BalanceHashHeader:
+	default:
+		return fmt.Errorf("balancing strategy of %v is invalid: %w", c, ErrValidation)
+	}
+
+	if (c.Balance == models.BalanceHashHeader) != (c.BalanceHeader != "") {
+		return fmt.Errorf("balance header of %v must be set only for %q balancing: %w",
+			c, models.BalanceHashHeader, ErrValidation)
+	}
+
+	return nil
+}
+
+func (c *createRouteDTO) validateRedirectCode() error {
+	if c.Type != models.RouteTypeRedirect {
+		if c.RedirectCode != 0 {
+			return fmt.Errorf("redirect code of %v is set for a non-redirect route: %w", c, ErrValidation)
+		}
+
+		return nil
+	}
+
+	switch c.RedirectCode {
+	case 0:
+		c.RedirectCode = http.StatusTemporaryRedirect
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("redirect code of %v is invalid: %w", c, ErrValidation)
+	}
+
+	return nil
+}
+
+func (p predicateDTO) toInfo() routing.Predicate {
+	return routing.NewPredicate(p.toModel())
+}
+
+func (p predicateDTO) toModel() models.Predicate {
+	return models.Predicate{
+		Model:   gorm.Model{}, //nolint:exhaustivestruct
+		RouteID: 0,
+		Kind:    p.Kind,
+		Name:    p.Name,
+		Op:      p.Op,
+		Value:   p.Value,
+	}
+}
+
+// validateFrom checks the source pattern and that all placeholders in the target can be filled.
+func (c *createRouteDTO) validateFrom() error {
+	var captures []string
+
+	if c.Mode == models.RouteModeHost && c.FromMatch != models.FromMatchRegex {
+		c.From = routing.NormalizeHost(c.From)
+	}
+
+	switch c.FromMatch {
+	case "", models.FromMatchExact:
+		c.FromMatch = models.FromMatchExact
+
+		if strings.Contains(c.From, "*") {
+			return fmt.Errorf("exact source of %v contains a wildcard: %w", c, ErrValidation)
+		}
+	case models.FromMatchWildcard:
+		if err := routing.ValidateWildcard(c.From); err != nil {
+			return fmt.Errorf("wildcard source of %v is invalid: %v: %w", c, err, ErrValidation)
+		}
+
+		captures = []string{"1"}
+	case models.FromMatchRegex:
+		re, err := routing.CompileHostPattern(c.From)
+		if err != nil {
+			return fmt.Errorf("regex source of %v is invalid: %v: %w", c, err, ErrValidation)
+		}
+
+		captures = routing.CaptureNames(re)
+	case models.FromMatchCIDR:
+		if c.Mode != models.RouteModeSource {
+			return fmt.Errorf("network source of %v requires %q mode: %w", c, models.RouteModeSource, ErrValidation)
+		}
+
+		_, network, err := net.ParseCIDR(c.From)
+		if err != nil {
+			return fmt.Errorf("network source of %v is invalid: %v: %w", c, err, ErrValidation)
+		}
+
+		c.From = network.String()
+	default:
+		return fmt.Errorf("source match of %v is invalid: %w", c, ErrValidation)
+	}
+
+	if c.Type == models.RouteTypeRedirect {
+		captures = append(captures, routing.RequestPlaceholders()...)
+	}
+
+	targets := []string{c.To}
+	for _, target := range c.Targets {
+		targets = append(targets, target.Address)
+	}
+
+	for _, target := range targets {
+		for _, placeholder := range routing.Placeholders(target) {
+			if !contains(captures, placeholder) {
+				return fmt.Errorf("placeholder %q in target of %v is not captured: %w", placeholder, c, ErrValidation)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -146,42 +514,150 @@ func (s Server) createRoute(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.routes.Set(route.From, routing.RouteInfo{
-		To:   route.To,
-		Type: route.Type,
+	if err := route.UpstreamTLS.validateCertificates(s.certificates); err != nil {
+		log.Printf("error validating dto: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	if err := route.validateListenPort(s.routes, s.ports); err != nil {
+		log.Printf("error validating dto: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	// The route is saved synchronously because its id is used as a key in the cache.
+	model := models.Route{
+		Model:          gorm.Model{}, //nolint:exhaustivestruct
+		From:           route.From,
+		FromMatch:      route.FromMatch,
+		To:             route.To,
+		Type:           route.Type,
+		Mode:           route.Mode,
+		Path:           route.Path,
+		PathMatch:      route.PathMatch,
+		StripPrefix:    route.StripPrefix,
+		Predicates:     nil,
+		Priority:       route.Priority,
+		QueryMode:      route.QueryMode,
+		RedirectCode:   route.RedirectCode,
+		FlushInterval:  route.FlushInterval,
+		Targets:        nil,
+		Balance:        route.Balance,
+		BalanceHeader:  route.BalanceHeader,
+		HealthCheck:    route.HealthCheck.toModel(),
+		CircuitBreaker: route.CircuitBreaker.toModel(),
+		Retry:          route.Retry.toModel(),
+		Timeouts:       route.Timeouts.toModel(),
+		Pool:           route.Pool.toModel(),
+		UpstreamTLS:    route.UpstreamTLS.toModel(),
+		HTTPS:          route.HTTPS.toModel(),
+		ACME:           route.ACME,
+		ListenPort:     route.ListenPort,
+	}
+
+	for _, predicate := range route.Predicates {
+		model.Predicates = append(model.Predicates, predicate.toModel())
+	}
+
+	for _, target := range route.Targets {
+		model.Targets = append(model.Targets, models.Target{
+			Model:   gorm.Model{}, //nolint:exhaustivestruct
+			RouteID: 0,
+			Address: target.Address,
+			Weight:  *target.Weight,
+		})
+	}
+
+	if err := saveRoute(s.db, &model); err != nil {
+		log.Printf("error saving route to db: %v", err)
+		http.Error(rw, "", http.StatusInternalServerError)
+
+		return
+	}
+
+	log.Printf("route saved to db")
+
+	info := routing.NewRouteInfo(model)
+	s.routes.Set(info)
+	s.streams.Sync()
+
+	conflicts := s.routes.Conflicts(info)
+	for _, conflict := range conflicts {
+		log.Printf("route %d conflicts with route %d, newer route will be used", info.ID, conflict.ID)
+	}
+
+	writeJSON(rw, http.StatusCreated, createRouteResponse{
+		Route:     info,
+		Conflicts: conflicts,
 	})
+}
 
-	s.workers.Add(1)
+// saveRoute creates the route with its predicates and targets.
+// Zero weights are replaced with the column default on insert, so targets out of rotation are updated afterwards.
+func saveRoute(db *gorm.DB, model *models.Route) error {
+	weights := make([]int, 0, len(model.Targets))
+	for _, target := range model.Targets {
+		weights = append(weights, target.Weight)
+	}
 
-	go func() {
-		defer s.workers.Done()
+	return db.Transaction(func(tx *gorm.DB) error { //nolint:wrapcheck
+		if err := tx.Create(model).Error; err != nil {
+			return fmt.Errorf("error creating route: %w", err)
+		}
 
-		if err := s.db.Save(&models.Route{
-			Model: gorm.Model{}, //nolint:exhaustivestruct
-			From:  route.From,
-			To:    route.To,
-			Type:  route.Type,
-		}).Error; err != nil {
-			log.Printf("error saving route to db: %v", err)
+		for i, weight := range weights {
+			if weight != 0 {
+				continue
+			}
 
-			return
+			model.Targets[i].Weight = 0
+
+			if err := tx.Model(&model.Targets[i]).Update("weight", 0).Error; err != nil {
+				return fmt.Errorf("error taking target %d out of rotation: %w", model.Targets[i].ID, err)
+			}
 		}
 
-		log.Printf("route saved to db")
-	}()
+		return nil
+	})
 }
 
+// createRouteResponse contains the created route and existing routes that match the same requests
+// with the same priority, so the choice between them depends only on the creation order.
+type createRouteResponse struct {
+	Route     routing.RouteInfo   `json:"route"`
+	Conflicts []routing.RouteInfo `json:"conflicts"`
+}
+
+// deleteRouteDTO selects either a single route by its id or all routes with the same source and mode.
+// Mode defaults to source, the same way as on creation.
 type deleteRouteDTO struct {
-	From string `json:"from"`
+	ID   uint             `json:"id"`
+	From string           `json:"from"`
+	Mode models.RouteMode `json:"mode"`
 }
 
 func (d *deleteRouteDTO) Validate() error {
 	d.From = strings.TrimSpace(d.From)
 
-	if d.From == "" {
+	if d.ID == 0 && d.From == "" {
 		return fmt.Errorf("one of the fields of %v is empty: %w", d, ErrValidation)
 	}
 
+	if d.Mode == "" {
+		d.Mode = models.RouteModeSource
+	}
+
+	if d.Mode != models.RouteModeSource && d.Mode != models.RouteModeHost {
+		return fmt.Errorf("mode of %v is invalid: %w", d, ErrValidation)
+	}
+
+	if d.Mode == models.RouteModeHost {
+		d.From = routing.NormalizeHost(d.From)
+	}
+
 	return nil
 }
 
@@ -211,14 +687,43 @@ func (s Server) deleteRoute(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.routes.Remove(route.From)
+	var ids []uint
+
+	for _, info := range s.routes.GetAll() {
+		if info.ID == route.ID || route.ID == 0 && info.From == route.From && info.Mode == route.Mode {
+			ids = append(ids, info.ID)
+			s.routes.Remove(info.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		api404(rw, r)
+
+		return
+	}
+
+	s.streams.Sync()
 
 	s.workers.Add(1)
 
 	go func() {
 		defer s.workers.Done()
 
-		if err := s.db.Where("`from` = ?", route.From).Delete(&models.Route{}).Error; err != nil { //nolint:exhaustivestruct
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("route_id IN ?", ids).Delete(&models.Predicate{}).Error; err != nil { //nolint:exhaustivestruct
+				return fmt.Errorf("error deleting predicates: %w", err)
+			}
+
+			if err := tx.Where("route_id IN ?", ids).Delete(&models.Target{}).Error; err != nil { //nolint:exhaustivestruct
+				return fmt.Errorf("error deleting targets: %w", err)
+			}
+
+			if err := tx.Delete(&models.Route{}, ids).Error; err != nil { //nolint:exhaustivestruct
+				return fmt.Errorf("error deleting routes: %w", err)
+			}
+
+			return nil
+		}); err != nil {
 			log.Printf("error deleting route from db: %v", err)
 
 			return
@@ -238,11 +743,17 @@ func (s Server) showDashboard(rw http.ResponseWriter, r *http.Request) {
 	hosts := s.autocomplete.Hosts()
 
 	if err := s.indexTemplate.Execute(rw, struct {
-		Routes map[string]routing.RouteInfo
-		Hosts  []string
+		Routes       []routing.RouteInfo
+		Hosts        []string
+		Certificates []certs.Certificate
+		Metrics      metrics.Snapshot
+		Streams      map[uint]stream.Stats
 	}{
 		s.routes.GetAll(),
 		hosts,
+		s.certificates.GetAll(),
+		s.metrics.Snapshot(),
+		s.streams.Stats(),
 	}); err != nil {
 		log.Printf("error executing template: %v", err)
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -251,6 +762,30 @@ func (s Server) showDashboard(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeJSON(rw http.ResponseWriter, status int, value interface{}) {
+	b, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		log.Printf("error marshaling response: %v", err)
+		http.Error(rw, "", http.StatusInternalServerError)
+
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_, _ = rw.Write(b)
+}
+
 func api404(rw http.ResponseWriter, r *http.Request) {
 	log.Printf("not found: %s", r.URL.Path)
 	http.NotFound(rw, r)
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+// maxPort is the largest TCP port.
+const maxPort = 65535
+
+// validateTCP checks a TCP route: it only has a listen port, targets with their balancing, health checks,
+// circuit breaker and dial timeout, HTTP settings are rejected.
+func (c *createRouteDTO) validateTCP() error {
+	if c.ListenPort <= 0 || c.ListenPort > maxPort {
+		return fmt.Errorf("listen port of %v is invalid: %w", c, ErrValidation)
+	}
+
+	if c.To == "" && len(c.Targets) == 0 {
+		return fmt.Errorf("target of %v is empty: %w", c, ErrValidation)
+	}
+
+	if c.From != "" || c.FromMatch != "" || c.Mode != "" || c.Path != "" || c.PathMatch != "" || c.StripPrefix ||
+		len(c.Predicates) != 0 || c.Priority != 0 || c.QueryMode != "" || c.FlushInterval != 0 ||
+		c.HTTPS != (httpsDTO{}) || c.ACME { //nolint:exhaustivestruct
+		return fmt.Errorf("http settings of %v are set for a tcp route: %w", c, ErrValidation)
+	}
+
+	if err := c.validateTargets(); err != nil {
+		return err
+	}
+
+	if c.Balance == models.BalanceHashHeader {
+		return fmt.Errorf("balancing strategy of %v requires headers: %w", c, ErrValidation)
+	}
+
+	addresses := []string{c.To}
+	for _, target := range c.Targets {
+		addresses = append(addresses, target.Address)
+	}
+
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+
+		if _, port, err := net.SplitHostPort(address); err != nil || port == "" ||
+			len(routing.Placeholders(address)) != 0 {
+			return fmt.Errorf("target %q of %v must be a host and a port: %w", address, c, ErrValidation)
+		}
+	}
+
+	if err := c.validateRedirectCode(); err != nil {
+		return err
+	}
+
+	if err := c.validateHealthCheck(); err != nil {
+		return err
+	}
+
+	if err := c.validateCircuitBreaker(); err != nil {
+		return err
+	}
+
+	if err := c.validateRetry(); err != nil {
+		return err
+	}
+
+	if err := c.validateTimeouts(); err != nil {
+		return err
+	}
+
+	if err := c.validatePool(); err != nil {
+		return err
+	}
+
+	return c.validateUpstreamTLS()
+}
+
+// validateListenPort checks that neither the servers nor other TCP routes listen on the port of the route.
+func (c *createRouteDTO) validateListenPort(routes *routing.Cache, ports []int) error {
+	if c.Type != models.RouteTypeTCP {
+		return nil
+	}
+
+	for _, port := range ports {
+		if port == c.ListenPort {
+			return fmt.Errorf("listen port of %v is used by the router: %w", c, ErrValidation)
+		}
+	}
+
+	for _, info := range routes.GetAll() {
+		if info.Type == models.RouteTypeTCP && info.ListenPort == c.ListenPort {
+			return fmt.Errorf("listen port of %v is used by route %d: %w", c, info.ID, ErrValidation)
+		}
+	}
+
+	return nil
+}
+
+func (s Server) listStreams(rw http.ResponseWriter, _ *http.Request) {
+	writeJSON(rw, http.StatusOK, s.streams.Stats())
+}
@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"fmt"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+// timeoutsDTO limits how long requests wait for targets, zero values are replaced with defaults.
+type timeoutsDTO struct {
+	Dial           models.Duration `json:"dial"`
+	TLSHandshake   models.Duration `json:"tlsHandshake"`
+	ResponseHeader models.Duration `json:"responseHeader"`
+	Request        models.Duration `json:"request"`
+}
+
+func (c *createRouteDTO) validateTimeouts() error {
+	timeouts := c.Timeouts
+
+	if timeouts == (timeoutsDTO{}) { //nolint:exhaustivestruct
+		return nil
+	}
+
+	if c.Type != models.RouteTypeProxy && c.Type != models.RouteTypeTCP {
+		return fmt.Errorf("timeouts of %v are set for a non-proxy route: %w", c, ErrValidation)
+	}
+
+	if c.Type == models.RouteTypeTCP && timeouts != (timeoutsDTO{Dial: timeouts.Dial}) { //nolint:exhaustivestruct
+		return fmt.Errorf("timeouts of tcp route %v other than the dial timeout are set: %w", c, ErrValidation)
+	}
+
+	if c.Pool.H2C && timeouts.TLSHandshake != 0 {
+		return fmt.Errorf("tls handshake timeout of %v is set for h2c targets: %w", c, ErrValidation)
+	}
+
+	if timeouts.Dial < 0 || timeouts.TLSHandshake < 0 || timeouts.ResponseHeader < 0 || timeouts.Request < 0 {
+		return fmt.Errorf("timeouts of %v are negative: %w", c, ErrValidation)
+	}
+
+	return nil
+}
+
+func (t timeoutsDTO) toModel() models.Timeouts {
+	return models.Timeouts{
+		Dial:           t.Dial,
+		TLSHandshake:   t.TLSHandshake,
+		ResponseHeader: t.ResponseHeader,
+		Request:        t.Request,
+	}
+}
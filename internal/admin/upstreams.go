@@ -0,0 +1,192 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"gorm.io/gorm"
+)
+
+// updateWeightsDTO changes weights of targets of the route with the id.
+type updateWeightsDTO struct {
+	ID      uint              `json:"id"`
+	Targets []targetWeightDTO `json:"targets"`
+}
+
+type targetWeightDTO struct {
+	ID     uint `json:"id"`
+	Weight int  `json:"weight"`
+}
+
+func (u *updateWeightsDTO) Validate(info routing.RouteInfo) error {
+	if len(u.Targets) == 0 {
+		return fmt.Errorf("no targets in %v: %w", u, ErrValidation)
+	}
+
+	for _, target := range u.Targets {
+		if target.Weight < 0 {
+			return fmt.Errorf("weight of target %d is negative: %w", target.ID, ErrValidation)
+		}
+
+		found := false
+
+		for _, existing := range info.Targets {
+			// Routes with a single To have a target without an id that can't be updated.
+			if existing.ID != 0 && existing.ID == target.ID {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("target %d doesn't belong to route %d: %w", target.ID, info.ID, ErrValidation)
+		}
+	}
+
+	return nil
+}
+
+func (s Server) updateWeights(rw http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("error reading weights from request body: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	var update updateWeightsDTO
+
+	err = json.Unmarshal(b, &update)
+	if err != nil {
+		log.Printf("error unmarshaling weights from request body: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	info, ok := s.routes.Get(update.ID)
+	if !ok {
+		api404(rw, r)
+
+		return
+	}
+
+	if err := update.Validate(info); err != nil {
+		log.Printf("error validating dto: %v", err)
+		http.Error(rw, "", http.StatusBadRequest)
+
+		return
+	}
+
+	weights := make(map[uint]int, len(update.Targets))
+	for _, target := range update.Targets {
+		weights[target.ID] = target.Weight
+	}
+
+	info, ok = s.routes.SetWeights(update.ID, weights)
+	if !ok {
+		api404(rw, r)
+
+		return
+	}
+
+	s.workers.Add(1)
+
+	go func() {
+		defer s.workers.Done()
+
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			for id, weight := range weights {
+				query := tx.Model(&models.Target{}).Where("id = ? AND route_id = ?", id, update.ID) //nolint:exhaustivestruct
+				if err := query.Update("weight", weight).Error; err != nil {
+					return fmt.Errorf("error updating weight of target %d: %w", id, err)
+				}
+			}
+
+			return nil
+		}); err != nil {
+			log.Printf("error updating weights in db: %v", err)
+
+			return
+		}
+
+		log.Printf("weights of route %d updated in db", update.ID)
+	}()
+
+	writeJSON(rw, http.StatusOK, info)
+}
+
+// upstreamDTO contains targets of a proxy or TCP route with their weights and counters.
+type upstreamDTO struct {
+	RouteID uint             `json:"routeId"`
+	Type    models.RouteType `json:"type"`
+	Balance models.Balance   `json:"balance"`
+	Targets []targetStatsDTO `json:"targets"`
+}
+
+type targetStatsDTO struct {
+	ID      uint       `json:"id"`
+	Address string     `json:"address"`
+	Weight  int        `json:"weight"`
+	Healthy bool       `json:"healthy"`
+	Circuit circuitDTO `json:"circuit"`
+	routing.TargetStats
+}
+
+type circuitDTO struct {
+	State     routing.CircuitState `json:"state"`
+	Failures  int                  `json:"failures"`
+	Ejections int                  `json:"ejections"`
+	Until     time.Time            `json:"until"`
+	Changed   time.Time            `json:"changed"`
+}
+
+func newCircuitDTO(circuit routing.Circuit) circuitDTO {
+	return circuitDTO{
+		State:     circuit.State,
+		Failures:  circuit.Failures,
+		Ejections: circuit.Ejections,
+		Until:     circuit.Until,
+		Changed:   circuit.Changed,
+	}
+}
+
+func (s Server) listUpstreams(rw http.ResponseWriter, _ *http.Request) {
+	upstreams := []upstreamDTO{}
+
+	for _, info := range s.routes.GetAll() {
+		if info.Type != models.RouteTypeProxy && info.Type != models.RouteTypeTCP {
+			continue
+		}
+
+		upstream := upstreamDTO{
+			RouteID: info.ID,
+			Type:    info.Type,
+			Balance: info.Balance,
+			Targets: nil,
+		}
+
+		for _, target := range info.Targets {
+			upstream.Targets = append(upstream.Targets, targetStatsDTO{
+				ID:          target.ID,
+				Address:     target.Address,
+				Weight:      target.Weight,
+				Healthy:     target.Healthy(),
+				Circuit:     newCircuitDTO(target.Circuit()),
+				TargetStats: target.Stats(),
+			})
+		}
+
+		upstreams = append(upstreams, upstream)
+	}
+
+	writeJSON(rw, http.StatusOK, upstreams)
+}
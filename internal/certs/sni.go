@@ -0,0 +1,74 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+var ErrNoServerCertificate = fmt.Errorf("no certificate for server name")
+
+// GetCertificate picks a certificate with a key for the server name requested by the client,
+// it's used as tls.Config.GetCertificate, so changes of the store apply to the next handshake.
+// Exact names are preferred over wildcards, and among equal matches the certificate valid for longer is used,
+// so a renewed certificate can be uploaded before the old one is deleted.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	var (
+		best      *Certificate
+		bestExact bool
+	)
+
+	for id := range s.certificates {
+		certificate := s.certificates[id]
+		if certificate.chain == nil {
+			continue
+		}
+
+		matches, exact := matchName(certificate.DNSNames, name)
+		if !matches {
+			continue
+		}
+
+		if best == nil || exact && !bestExact ||
+			exact == bestExact && certificate.NotAfter.After(best.NotAfter) {
+			best, bestExact = &certificate, exact
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("%q: %w", name, ErrNoServerCertificate)
+	}
+
+	return best.chain, nil
+}
+
+// matchName reports whether one of the names matches the server name and whether the match is exact.
+// Wildcard names like "*.example.com" match a single label.
+func matchName(names []string, serverName string) (bool, bool) {
+	if serverName == "" {
+		return false, false
+	}
+
+	matches := false
+
+	for _, name := range names {
+		name = strings.ToLower(name)
+
+		if name == serverName {
+			return true, true
+		}
+
+		if strings.HasPrefix(name, "*.") {
+			if i := strings.IndexByte(serverName, '.'); i > 0 && serverName[i:] == name[1:] {
+				matches = true
+			}
+		}
+	}
+
+	return matches, false
+}
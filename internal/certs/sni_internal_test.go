@@ -0,0 +1,82 @@
+package certs
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+//nolint:funlen
+func TestStore_GetCertificate(t *testing.T) {
+	t.Parallel()
+
+	store := New()
+
+	for i, certificate := range []struct {
+		name     string
+		validFor time.Duration
+		names    []string
+		withKey  bool
+	}{
+		{name: "exact", validFor: time.Hour, names: []string{"www.example.com"}, withKey: true},
+		{name: "wildcard", validFor: time.Hour, names: []string{"*.example.com", "example.com"}, withKey: true},
+		{name: "renewed wildcard", validFor: 2 * time.Hour, names: []string{"*.example.com"}, withKey: true},
+		{name: "ca", validFor: time.Hour, names: []string{"example.org"}, withKey: false},
+	} {
+		pem, key := selfSigned(t, certificate.validFor, certificate.names...)
+		if !certificate.withKey {
+			key = ""
+		}
+
+		parsed, err := Parse(models.Certificate{
+			Model:       gorm.Model{ID: uint(i + 1)}, //nolint:exhaustivestruct
+			Name:        certificate.name,
+			Certificate: pem,
+			Key:         key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store.Set(parsed)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{serverName: "www.example.com", want: "www.example.com"},
+		{serverName: "WWW.example.com.", want: "www.example.com"},
+		{serverName: "api.example.com", want: "*.example.com"},
+		{serverName: "example.com", want: "*.example.com"},
+		{serverName: "a.b.example.com"},
+		{serverName: "example.org"},
+		{serverName: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.serverName, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName}) //nolint:exhaustivestruct
+			if tt.want == "" {
+				assert.ErrorIs(t, err, ErrNoServerCertificate)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Leaf.DNSNames[0])
+		})
+	}
+
+	renewed, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"}) //nolint:exhaustivestruct
+	assert.NoError(t, err)
+	assert.Len(t, renewed.Leaf.DNSNames, 1, "the certificate valid for longer should be used")
+}
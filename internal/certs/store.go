@@ -0,0 +1,209 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+var (
+	ErrNoCertificate      = fmt.Errorf("no certificate in PEM data")
+	ErrUnknownCertificate = fmt.Errorf("unknown certificate")
+	ErrNoKey              = fmt.Errorf("certificate has no key")
+)
+
+// Certificate is a parsed stored certificate, keys and parsed data are never encoded to JSON.
+type Certificate struct {
+	ID   uint
+	Name string
+	// Subject, DNSNames, NotBefore and NotAfter describe the first certificate of the chain.
+	Subject   string
+	DNSNames  []string
+	NotBefore time.Time
+	NotAfter  time.Time
+	HasKey    bool
+	// chain is the certificate with its key, nil for CA bundles.
+	chain *tls.Certificate
+	// pool contains all certificates of the PEM data for verifying peers.
+	pool *x509.CertPool
+}
+
+// Parse parses PEM data of the certificate and its key if there is one.
+func Parse(model models.Certificate) (Certificate, error) {
+	var parsed []*x509.Certificate
+
+	rest := []byte(model.Certificate)
+
+	for {
+		var block *pem.Block
+
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return Certificate{}, fmt.Errorf("error parsing certificate %q: %w", model.Name, err)
+		}
+
+		parsed = append(parsed, certificate)
+	}
+
+	if len(parsed) == 0 {
+		return Certificate{}, fmt.Errorf("certificate %q: %w", model.Name, ErrNoCertificate)
+	}
+
+	pool := x509.NewCertPool()
+	for _, certificate := range parsed {
+		pool.AddCert(certificate)
+	}
+
+	result := Certificate{
+		ID:        model.ID,
+		Name:      model.Name,
+		Subject:   parsed[0].Subject.String(),
+		DNSNames:  parsed[0].DNSNames,
+		NotBefore: parsed[0].NotBefore,
+		NotAfter:  parsed[0].NotAfter,
+		HasKey:    model.Key != "",
+		chain:     nil,
+		pool:      pool,
+	}
+
+	if model.Key != "" {
+		chain, err := tls.X509KeyPair([]byte(model.Certificate), []byte(model.Key))
+		if err != nil {
+			return Certificate{}, fmt.Errorf("error parsing key of certificate %q: %w", model.Name, err)
+		}
+
+		// Keeping the parsed leaf saves parsing it on every handshake.
+		chain.Leaf = parsed[0]
+		result.chain = &chain
+	}
+
+	return result, nil
+}
+
+// Store keeps parsed certificates in memory.
+type Store struct {
+	certificates map[uint]Certificate
+	// revision changes with every change of certificates, so users of certificates know when to reload them.
+	revision uint64
+	m        sync.RWMutex
+}
+
+func New() Store {
+	return Store{
+		certificates: make(map[uint]Certificate),
+		revision:     0,
+		m:            sync.RWMutex{},
+	}
+}
+
+func (s *Store) Set(certificate Certificate) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.certificates[certificate.ID] = certificate
+	s.revision++
+}
+
+func (s *Store) Get(id uint) (Certificate, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	certificate, ok := s.certificates[id]
+
+	return certificate, ok
+}
+
+// GetByName returns the certificate with the name.
+func (s *Store) GetByName(name string) (Certificate, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	for _, certificate := range s.certificates {
+		if certificate.Name == name {
+			return certificate, true
+		}
+	}
+
+	return Certificate{}, false
+}
+
+// GetAll returns all certificates ordered by name.
+func (s *Store) GetAll() []Certificate {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	result := make([]Certificate, 0, len(s.certificates))
+	for _, certificate := range s.certificates {
+		result = append(result, certificate)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func (s *Store) Remove(id uint) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.certificates, id)
+	s.revision++
+}
+
+// Revision returns a number that changes with every change of certificates.
+func (s *Store) Revision() uint64 {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.revision
+}
+
+// ClientConfig returns the TLS configuration for connecting to targets of a route.
+func (s *Store) ClientConfig(settings models.UpstreamTLS) (*tls.Config, error) {
+	config := &tls.Config{ //nolint:exhaustivestruct
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if settings.CA != "" {
+		ca, ok := s.GetByName(settings.CA)
+		if !ok {
+			return nil, fmt.Errorf("ca %q: %w", settings.CA, ErrUnknownCertificate)
+		}
+
+		config.RootCAs = ca.pool
+	}
+
+	if settings.ClientCertificate != "" {
+		certificate, ok := s.GetByName(settings.ClientCertificate)
+		if !ok {
+			return nil, fmt.Errorf("client certificate %q: %w", settings.ClientCertificate, ErrUnknownCertificate)
+		}
+
+		if certificate.chain == nil {
+			return nil, fmt.Errorf("client certificate %q: %w", settings.ClientCertificate, ErrNoKey)
+		}
+
+		config.Certificates = []tls.Certificate{*certificate.chain}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,125 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// selfSigned returns a PEM encoded self-signed certificate for the names valid for the duration and its key.
+func selfSigned(t *testing.T, validFor time.Duration, names ...string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{ //nolint:exhaustivestruct
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]}, //nolint:exhaustivestruct
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), //nolint:exhaustivestruct
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})) //nolint:exhaustivestruct
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	certificate, key := selfSigned(t, time.Hour, "example.com")
+	_, otherKey := selfSigned(t, time.Hour, "example.org")
+
+	tests := []struct {
+		name        string
+		certificate string
+		key         string
+		wantKey     bool
+		wantErr     bool
+	}{
+		{name: "ca bundle", certificate: certificate},
+		{name: "with key", certificate: certificate, key: key, wantKey: true},
+		{name: "no certificate", certificate: key, wantErr: true},
+		{name: "mismatched key", certificate: certificate, key: otherKey, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse(models.Certificate{ //nolint:exhaustivestruct
+				Model:       gorm.Model{ID: 1}, //nolint:exhaustivestruct
+				Name:        tt.name,
+				Certificate: tt.certificate,
+				Key:         tt.key,
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"example.com"}, got.DNSNames)
+			assert.Equal(t, tt.wantKey, got.HasKey)
+			assert.Equal(t, tt.wantKey, got.chain != nil)
+		})
+	}
+}
+
+func TestStore_ClientConfig(t *testing.T) {
+	t.Parallel()
+
+	certificate, key := selfSigned(t, time.Hour, "example.com")
+	store := New()
+
+	for i, model := range []models.Certificate{
+		{Name: "ca", Certificate: certificate},               //nolint:exhaustivestruct
+		{Name: "client", Certificate: certificate, Key: key}, //nolint:exhaustivestruct
+	} {
+		model.ID = uint(i + 1)
+
+		parsed, err := Parse(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store.Set(parsed)
+	}
+
+	config, err := store.ClientConfig(models.UpstreamTLS{CA: "ca", ClientCertificate: "client"}) //nolint:exhaustivestruct
+	assert.NoError(t, err)
+	assert.NotNil(t, config.RootCAs)
+	assert.Len(t, config.Certificates, 1)
+
+	_, err = store.ClientConfig(models.UpstreamTLS{CA: "unknown"}) //nolint:exhaustivestruct
+	assert.ErrorIs(t, err, ErrUnknownCertificate)
+
+	_, err = store.ClientConfig(models.UpstreamTLS{ClientCertificate: "ca"}) //nolint:exhaustivestruct
+	assert.ErrorIs(t, err, ErrNoKey)
+}
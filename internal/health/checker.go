@@ -0,0 +1,300 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iskorotkov/router/internal/certs"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+// resolution is how often the checker looks for targets that are due for a probe.
+const resolution = time.Second
+
+var (
+	ErrUnexpectedStatus = fmt.Errorf("unexpected status code")
+	ErrUnknownCheck     = fmt.Errorf("unknown health check type")
+)
+
+// Checker probes targets of proxy and TCP routes with health checks and takes failing targets out of rotation.
+type Checker struct {
+	routes       *routing.Cache
+	certificates *certs.Store
+	workers      *sync.WaitGroup
+	client       *http.Client
+	probes       map[probeKey]*probe
+	results      chan result
+}
+
+type probeKey struct {
+	route   uint
+	target  uint
+	address string
+}
+
+// probe holds results of a target between checks.
+type probe struct {
+	target    routing.Target
+	next      time.Time
+	running   bool
+	successes int
+	failures  int
+}
+
+type result struct {
+	key probeKey
+	err error
+}
+
+func NewChecker(routes *routing.Cache, certificates *certs.Store, workers *sync.WaitGroup) *Checker {
+	return &Checker{
+		routes:       routes,
+		certificates: certificates,
+		workers:      workers,
+		client: &http.Client{ //nolint:exhaustivestruct
+			// Redirects are successful responses of the target itself.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		probes:  make(map[probeKey]*probe),
+		results: make(chan result),
+	}
+}
+
+// Run probes targets until the context is canceled.
+// Probes in progress are added to the wait group of the checker, so waiting for it also waits for them.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.schedule(ctx, now)
+		case res := <-c.results:
+			c.record(res)
+		}
+	}
+}
+
+// schedule starts probes of targets that are due and forgets targets of removed routes.
+func (c *Checker) schedule(ctx context.Context, now time.Time) {
+	seen := make(map[probeKey]bool)
+
+	for _, info := range c.routes.GetAll() {
+		if info.Type != models.RouteTypeProxy && info.Type != models.RouteTypeTCP || info.HealthCheck.Type == "" {
+			continue
+		}
+
+		for _, target := range info.Targets {
+			// Targets built from captured values are only known when a request arrives.
+			if len(routing.Placeholders(target.Address)) != 0 {
+				continue
+			}
+
+			key := probeKey{route: info.ID, target: target.ID, address: target.Address}
+			seen[key] = true
+
+			p, ok := c.probes[key]
+			if !ok {
+				p = &probe{target: target, next: now, running: false, successes: 0, failures: 0}
+				c.probes[key] = p
+			}
+
+			p.target = target
+
+			if p.running || now.Before(p.next) {
+				continue
+			}
+
+			p.running = true
+			p.next = now.Add(time.Duration(info.HealthCheck.Interval))
+
+			c.workers.Add(1)
+
+			go func(check models.HealthCheck, settings models.UpstreamTLS, h2c bool) {
+				defer c.workers.Done()
+
+				err := c.check(ctx, check, settings, h2c, key.address)
+
+				select {
+				case c.results <- result{key: key, err: err}:
+				case <-ctx.Done():
+				}
+			}(info.HealthCheck, info.UpstreamTLS, info.Pool.H2C)
+		}
+	}
+
+	for key := range c.probes {
+		if !seen[key] {
+			delete(c.probes, key)
+		}
+	}
+}
+
+// record counts the result of the probe and changes the health of the target once a threshold is reached.
+func (c *Checker) record(res result) {
+	p, ok := c.probes[res.key]
+	if !ok {
+		return
+	}
+
+	p.running = false
+
+	info, ok := c.routes.Get(res.key.route)
+	if !ok {
+		return
+	}
+
+	check := info.HealthCheck
+
+	if res.err == nil {
+		p.successes++
+		p.failures = 0
+
+		if p.successes >= check.HealthyThreshold && p.target.SetHealthy(true) {
+			log.Printf("target %q of route %d is healthy", res.key.address, res.key.route)
+		}
+
+		return
+	}
+
+	p.failures++
+	p.successes = 0
+
+	if p.failures >= check.UnhealthyThreshold && p.target.SetHealthy(false) {
+		log.Printf("target %q of route %d is unhealthy: %v", res.key.address, res.key.route, res.err)
+	}
+}
+
+// check probes the target, h2c targets are probed over HTTP/2 like the router reaches them.
+func (c *Checker) check(
+	ctx context.Context,
+	check models.HealthCheck,
+	settings models.UpstreamTLS,
+	h2c bool,
+	address string,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(check.Timeout))
+	defer cancel()
+
+	scheme := settings.Scheme
+	if h2c {
+		scheme = "http"
+	}
+
+	target, err := parseAddress(address, scheme)
+	if err != nil {
+		return err
+	}
+
+	switch check.Type {
+	case models.HealthCheckTCP:
+		return checkTCP(ctx, target)
+	case models.HealthCheckHTTP:
+		target.Path = check.Path
+
+		return c.checkHTTP(ctx, target, settings, h2c)
+	default:
+		return fmt.Errorf("%q: %w", check.Type, ErrUnknownCheck)
+	}
+}
+
+func checkTCP(ctx context.Context, target *url.URL) error {
+	host := target.Host
+	if target.Port() == "" {
+		host = net.JoinHostPort(target.Hostname(), defaultPort(target.Scheme))
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("error connecting to %q: %w", host, err)
+	}
+
+	_ = conn.Close()
+
+	return nil
+}
+
+func (c *Checker) checkHTTP(ctx context.Context, target *url.URL, settings models.UpstreamTLS, h2c bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request to %q: %w", target, err)
+	}
+
+	client := c.client
+
+	switch {
+	case h2c:
+		// Targets expecting HTTP/2 without negotiation don't answer HTTP/1 requests.
+		transport := &http.Transport{Protocols: &http.Protocols{}} //nolint:exhaustivestruct
+		transport.Protocols.SetUnencryptedHTTP2(true)
+		defer transport.CloseIdleConnections()
+
+		client = &http.Client{Transport: transport, CheckRedirect: c.client.CheckRedirect} //nolint:exhaustivestruct
+	case target.Scheme == "https":
+		// Targets are verified the same way the router does it.
+		tlsConfig, err := c.certificates.ClientConfig(settings)
+		if err != nil {
+			return fmt.Errorf("error configuring tls for %q: %w", target, err)
+		}
+
+		transport := &http.Transport{TLSClientConfig: tlsConfig} //nolint:exhaustivestruct
+		defer transport.CloseIdleConnections()
+
+		client = &http.Client{Transport: transport, CheckRedirect: c.client.CheckRedirect} //nolint:exhaustivestruct
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error requesting %q: %w", target, err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%q responded with %d: %w", target, resp.StatusCode, ErrUnexpectedStatus)
+	}
+
+	return nil
+}
+
+// parseAddress parses a target address the same way the router does,
+// plain addresses use the scheme of the route or HTTP.
+func parseAddress(address, scheme string) (*url.URL, error) {
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	if !strings.Contains(address, "://") {
+		address = scheme + "://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing target %q: %w", address, err)
+	}
+
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}, nil //nolint:exhaustivestruct
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+
+	return "80"
+}
@@ -0,0 +1,204 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/certs"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func closedAddress(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+	_ = l.Close()
+
+	return address
+}
+
+//nolint:funlen
+func TestChecker_schedule(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	// Parallel subtests run after the test function returns.
+	t.Cleanup(upstream.Close)
+
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The target only speaks HTTP/2 over plain connections, like gRPC servers.
+	h2cUpstream := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	h2cUpstream.Config.Protocols = &http.Protocols{}
+	h2cUpstream.Config.Protocols.SetUnencryptedHTTP2(true)
+	h2cUpstream.Start()
+	t.Cleanup(h2cUpstream.Close)
+
+	tests := []struct {
+		name    string
+		check   models.HealthCheck
+		pool    models.Pool
+		address string
+		healthy []bool
+	}{
+		{
+			name:    "http",
+			check:   models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/health"}, //nolint:exhaustivestruct
+			address: u.Host,
+			healthy: []bool{true, true, true},
+		},
+		{
+			name:    "http error status",
+			check:   models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/"}, //nolint:exhaustivestruct
+			address: upstream.URL,
+			healthy: []bool{true, false, false},
+		},
+		{
+			name:    "h2c",
+			check:   models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/health"}, //nolint:exhaustivestruct
+			pool:    models.Pool{H2C: true},                                            //nolint:exhaustivestruct
+			address: h2cUpstream.Listener.Addr().String(),
+			healthy: []bool{true, true, true},
+		},
+		{
+			name:    "h2c target probed over http/1",
+			check:   models.HealthCheck{Type: models.HealthCheckHTTP, Path: "/health"}, //nolint:exhaustivestruct
+			address: h2cUpstream.Listener.Addr().String(),
+			healthy: []bool{true, false, false},
+		},
+		{
+			name:    "tcp",
+			check:   models.HealthCheck{Type: models.HealthCheckTCP}, //nolint:exhaustivestruct
+			address: u.Host,
+			healthy: []bool{true, true, true},
+		},
+		{
+			name:    "tcp connection refused",
+			check:   models.HealthCheck{Type: models.HealthCheckTCP}, //nolint:exhaustivestruct
+			address: closedAddress(t),
+			healthy: []bool{true, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.check.UnhealthyThreshold = 2
+
+			routes := routing.New()
+			routes.Set(routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+				Model:       gorm.Model{ID: 1}, //nolint:exhaustivestruct
+				From:        "example.com",
+				Type:        models.RouteTypeProxy,
+				Targets:     []models.Target{{Address: tt.address, Weight: 1}}, //nolint:exhaustivestruct
+				HealthCheck: tt.check,
+				Pool:        tt.pool,
+			}))
+
+			var workers sync.WaitGroup
+			defer workers.Wait()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			certificates := certs.New()
+			c := NewChecker(&routes, &certificates, &workers)
+			now := time.Now()
+
+			for i, healthy := range tt.healthy {
+				c.schedule(ctx, now)
+				c.record(<-c.results)
+
+				info, _ := routes.Get(1)
+				assert.Equal(t, healthy, info.Targets[0].Healthy(), "check %d", i)
+
+				now = now.Add(time.Duration(info.HealthCheck.Interval))
+			}
+		})
+	}
+}
+
+func TestChecker_scheduleRecovery(t *testing.T) {
+	t.Parallel()
+
+	var (
+		m       sync.Mutex
+		healthy = false
+	)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+
+		if !healthy {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	routes := routing.New()
+	routes.Set(routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+		Model:   gorm.Model{ID: 1}, //nolint:exhaustivestruct
+		From:    "example.com",
+		Type:    models.RouteTypeProxy,
+		Targets: []models.Target{{Address: upstream.URL, Weight: 1}}, //nolint:exhaustivestruct
+		HealthCheck: models.HealthCheck{ //nolint:exhaustivestruct
+			Type:               models.HealthCheckHTTP,
+			HealthyThreshold:   2,
+			UnhealthyThreshold: 1,
+		},
+	}))
+
+	var workers sync.WaitGroup
+	defer workers.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	certificates := certs.New()
+	c := NewChecker(&routes, &certificates, &workers)
+	now := time.Now()
+
+	probe := func() bool {
+		c.schedule(ctx, now)
+		c.record(<-c.results)
+
+		now = now.Add(time.Minute)
+		info, _ := routes.Get(1)
+
+		return info.Targets[0].Healthy()
+	}
+
+	assert.False(t, probe())
+
+	m.Lock()
+	healthy = true
+	m.Unlock()
+
+	assert.False(t, probe(), "a single success is below the healthy threshold")
+	assert.True(t, probe())
+}
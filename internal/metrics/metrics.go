@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"sync/atomic"
+)
+
+// Protocols of client connections of the router.
+const (
+	ProtocolHTTP1 = "http/1.1"
+	ProtocolHTTP2 = "h2"
+	ProtocolH2C   = "h2c"
+	ProtocolHTTP3 = "h3"
+)
+
+// Metrics holds counters shared between the router and the admin servers.
+// All methods are safe for concurrent use.
+type Metrics struct {
+	upgradedOpen  int64
+	upgradedTotal int64
+	retries       int64
+	retriesDenied int64
+	// connections is keyed by protocol, the map itself is never modified after creation.
+	connections map[string]*connectionCounters
+}
+
+type connectionCounters struct {
+	open  int64
+	total int64
+}
+
+func New() *Metrics {
+	connections := make(map[string]*connectionCounters)
+	for _, protocol := range []string{ProtocolHTTP1, ProtocolHTTP2, ProtocolH2C, ProtocolHTTP3} {
+		connections[protocol] = &connectionCounters{open: 0, total: 0}
+	}
+
+	return &Metrics{
+		upgradedOpen:  0,
+		upgradedTotal: 0,
+		retries:       0,
+		retriesDenied: 0,
+		connections:   connections,
+	}
+}
+
+// Snapshot is a point-in-time copy of all counters.
+type Snapshot struct {
+	UpgradedConnectionsOpen  int64 `json:"upgradedConnectionsOpen"`
+	UpgradedConnectionsTotal int64 `json:"upgradedConnectionsTotal"`
+	Retries                  int64 `json:"retries"`
+	RetriesDenied            int64 `json:"retriesDenied"`
+	// Connections are client connections keyed by protocol.
+	Connections map[string]ConnectionCounts `json:"connections"`
+}
+
+type ConnectionCounts struct {
+	Open  int64 `json:"open"`
+	Total int64 `json:"total"`
+}
+
+func (m *Metrics) Snapshot() Snapshot {
+	connections := make(map[string]ConnectionCounts, len(m.connections))
+	for protocol, counters := range m.connections {
+		connections[protocol] = ConnectionCounts{
+			Open:  atomic.LoadInt64(&counters.open),
+			Total: atomic.LoadInt64(&counters.total),
+		}
+	}
+
+	return Snapshot{
+		UpgradedConnectionsOpen:  atomic.LoadInt64(&m.upgradedOpen),
+		UpgradedConnectionsTotal: atomic.LoadInt64(&m.upgradedTotal),
+		Retries:                  atomic.LoadInt64(&m.retries),
+		RetriesDenied:            atomic.LoadInt64(&m.retriesDenied),
+		Connections:              connections,
+	}
+}
+
+// ConnectionOpened records a client connection using one of the Protocol constants, other protocols are ignored.
+func (m *Metrics) ConnectionOpened(protocol string) {
+	if counters, ok := m.connections[protocol]; ok {
+		atomic.AddInt64(&counters.open, 1)
+		atomic.AddInt64(&counters.total, 1)
+	}
+}
+
+// ConnectionClosed records closing of a connection previously passed to ConnectionOpened.
+func (m *Metrics) ConnectionClosed(protocol string) {
+	if counters, ok := m.connections[protocol]; ok {
+		atomic.AddInt64(&counters.open, -1)
+	}
+}
+
+// ConnectionSwitched moves an open connection to another protocol once it's known, as if it used it from the start.
+func (m *Metrics) ConnectionSwitched(from, to string) {
+	if counters, ok := m.connections[from]; ok {
+		atomic.AddInt64(&counters.open, -1)
+		atomic.AddInt64(&counters.total, -1)
+	}
+
+	m.ConnectionOpened(to)
+}
+
+// UpgradeOpened records a connection switched to another protocol (e.g. WebSocket).
+func (m *Metrics) UpgradeOpened() {
+	atomic.AddInt64(&m.upgradedOpen, 1)
+	atomic.AddInt64(&m.upgradedTotal, 1)
+}
+
+// UpgradeClosed records closing of a connection previously passed to UpgradeOpened.
+func (m *Metrics) UpgradeClosed() {
+	atomic.AddInt64(&m.upgradedOpen, -1)
+}
+
+// Retried records a request sent to an upstream again after a failure.
+func (m *Metrics) Retried() {
+	atomic.AddInt64(&m.retries, 1)
+}
+
+// RetryDenied records a retry that was not made because the retry budget was exhausted.
+func (m *Metrics) RetryDenied() {
+	atomic.AddInt64(&m.retriesDenied, 1)
+}
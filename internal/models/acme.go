@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// ACMEEntry is a value kept by the ACME client: the account key, issued certificates with their keys
+// and responses to challenges in progress. Key is the name the ACME client uses for the value.
+type ACMEEntry struct {
+	Key       string `gorm:"primaryKey"`
+	Data      []byte
+	UpdatedAt time.Time
+}
@@ -0,0 +1,10 @@
+package models
+
+// CircuitBreaker ejects a target of a proxy route after Failures 5xx responses or connection errors in a row.
+// After the ejection the target gets a single trial request: a success returns it to rotation
+// and a failure ejects it again for twice as long, up to MaxEjection. Zero Failures disables the breaker.
+type CircuitBreaker struct {
+	Failures    int
+	Ejection    Duration
+	MaxEjection Duration
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Certificate is a PEM encoded certificate chain with an optional PEM encoded private key.
+// Certificates without a key are CA bundles used to verify peers.
+type Certificate struct {
+	gorm.Model
+	// Name is a unique name routes use to refer to the certificate.
+	Name        string
+	Certificate string
+	Key         string
+}
+
+// UpstreamTLS configures TLS connections of a proxy route to its targets.
+// Scheme is used for targets without one instead of the scheme of the incoming request.
+// CA and ClientCertificate are names of stored certificates: CA replaces system roots for verifying targets,
+// and ClientCertificate must have a key and is presented to targets requiring mutual TLS.
+// ServerName overrides the name sent in SNI and verified in certificates of targets.
+// InsecureSkipVerify doesn't verify targets at all and is meant only for development.
+type UpstreamTLS struct {
+	Scheme             string
+	CA                 string
+	ClientCertificate  string
+	ServerName         string
+	InsecureSkipVerify bool
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidDuration = fmt.Errorf("invalid duration")
+
+// Duration is a time.Duration stored as nanoseconds and encoded in JSON as a string like "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(time.Duration(d).String())
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling duration: %w", err)
+	}
+
+	return b, nil
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration %s must be a string like \"1m30s\": %w", b, ErrInvalidDuration)
+	}
+
+	if s == "" {
+		*d = 0
+
+		return nil
+	}
+
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("error parsing duration %q: %v: %w", s, err, ErrInvalidDuration)
+	}
+
+	*d = Duration(value)
+
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
@@ -0,0 +1,22 @@
+package models
+
+const (
+	// HealthCheckHTTP sends GET requests to Path of the target, responses with 2xx and 3xx codes are successful.
+	HealthCheckHTTP HealthCheckType = "http"
+	// HealthCheckTCP only opens a connection to the target.
+	HealthCheckTCP HealthCheckType = "tcp"
+)
+
+type HealthCheckType string
+
+// HealthCheck periodically probes targets of a proxy route.
+// A target is taken out of rotation after UnhealthyThreshold failed probes in a row
+// and returned after HealthyThreshold successful ones. Empty Type disables checks.
+type HealthCheck struct {
+	Type               HealthCheckType
+	Path               string
+	Interval           Duration
+	Timeout            Duration
+	HealthyThreshold   int
+	UnhealthyThreshold int
+}
@@ -0,0 +1,12 @@
+package models
+
+// HTTPS makes clients of a route use HTTPS.
+// Redirect sends plain HTTP requests to the same URL over HTTPS keeping the method and the body.
+// HSTSMaxAge adds Strict-Transport-Security to responses over HTTPS, zero doesn't add it.
+// HSTSIncludeSubdomains and HSTSPreload add includeSubDomains and preload directives to it.
+type HTTPS struct {
+	Redirect              bool
+	HSTSMaxAge            Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+}
@@ -0,0 +1,18 @@
+package models
+
+// Pool tunes connections to every target of a proxy route, each target has its own pool.
+// MaxIdleConns is the number of idle connections kept for reuse, MaxConnsPerHost limits all connections
+// to a target including active ones, zero means no limit. IdleTimeout closes idle connections that weren't reused,
+// KeepAlive is the period of TCP keep-alive probes, negative disables them.
+// DisableHTTP2 stops negotiating HTTP/2 with TLS targets. Zero values are replaced with defaults.
+// H2C speaks HTTP/2 over plain connections to targets that expect it without negotiation (e.g. gRPC servers),
+// requests to such targets are multiplexed over connections opened as needed, so MaxIdleConns and MaxConnsPerHost
+// can't be set for them.
+type Pool struct {
+	MaxIdleConns    int
+	MaxConnsPerHost int
+	IdleTimeout     Duration
+	KeepAlive       Duration
+	DisableHTTP2    bool
+	H2C             bool
+}
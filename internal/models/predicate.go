@@ -0,0 +1,35 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	// PredicateKindHeader checks values of the request header Name.
+	PredicateKindHeader PredicateKind = "header"
+	// PredicateKindCookie checks the value of the cookie Name.
+	PredicateKindCookie PredicateKind = "cookie"
+	// PredicateKindMethod checks the request method, Name is not used.
+	PredicateKindMethod PredicateKind = "method"
+)
+
+type PredicateKind string
+
+const (
+	PredicateOpEquals  PredicateOp = "equals"
+	PredicateOpRegex   PredicateOp = "regex"
+	PredicateOpPresent PredicateOp = "present"
+	PredicateOpAbsent  PredicateOp = "absent"
+)
+
+type PredicateOp string
+
+// Predicate is an additional condition that a request must satisfy to use the route.
+type Predicate struct {
+	gorm.Model
+	RouteID uint
+	Kind    PredicateKind
+	Name    string
+	Op      PredicateOp
+	Value   string
+}
@@ -0,0 +1,26 @@
+package models
+
+const (
+	// RetryOnConnect retries requests that failed to connect to the target.
+	RetryOnConnect RetryError = "connect"
+	// RetryOnTimeout retries requests that timed out.
+	RetryOnTimeout RetryError = "timeout"
+	// RetryOnReset retries requests that failed after connecting, e.g. when the connection was reset.
+	RetryOnReset RetryError = "reset"
+)
+
+type RetryError string
+
+// Retry sends failed requests of a proxy route again, each time to a newly picked target.
+// Attempts is the maximum number of attempts including the first one, values below 2 disable retries.
+// Statuses and Errors are comma-separated lists of response codes and RetryError values that are retried.
+// Retries wait for Backoff doubled after every attempt, up to MaxBackoff.
+// Only idempotent methods are retried unless NonIdempotent is set.
+type Retry struct {
+	Attempts      int
+	Statuses      string
+	Errors        string
+	Backoff       Duration
+	MaxBackoff    Duration
+	NonIdempotent bool
+}
@@ -7,13 +7,97 @@ import (
 const (
 	RouteTypeRedirect RouteType = "redirect"
 	RouteTypeProxy    RouteType = "proxy"
+	// RouteTypeTCP accepts connections on ListenPort and copies bytes between them and targets as is.
+	// From, paths and other HTTP settings aren't used.
+	RouteTypeTCP RouteType = "tcp"
 )
 
 type RouteType string
 
+const (
+	// RouteModeSource matches From against the address of the client.
+	RouteModeSource RouteMode = "source"
+	// RouteModeHost matches From against the Host header (or the SNI name under TLS).
+	// Host names are compared in lower case and without the trailing dot.
+	RouteModeHost RouteMode = "host"
+)
+
+type RouteMode string
+
+const (
+	// PathMatchPrefix matches all paths that start with Path at a segment boundary.
+	PathMatchPrefix PathMatch = "prefix"
+	// PathMatchExact matches only the path that is equal to Path.
+	PathMatchExact PathMatch = "exact"
+)
+
+type PathMatch string
+
+const (
+	// FromMatchExact compares From with the address as is.
+	FromMatchExact FromMatch = "exact"
+	// FromMatchWildcard treats From as "*.example.com" matching any direct subdomain of example.com,
+	// "a.example.com" matches it and "a.b.example.com" doesn't.
+	// The matched subdomain is available in To as "{1}".
+	FromMatchWildcard FromMatch = "wildcard"
+	// FromMatchRegex treats From as a regular expression matching the whole address.
+	// Named and numbered groups are available in To as "{name}" and "{1}".
+	FromMatchRegex FromMatch = "regex"
+	// FromMatchCIDR treats From as a network like "10.1.0.0/16" and matches client addresses inside it.
+	// Only available for RouteModeSource.
+	FromMatchCIDR FromMatch = "cidr"
+)
+
+type FromMatch string
+
+const (
+	// QueryModeAppend sends the query of the request followed by the query of To.
+	QueryModeAppend QueryMode = "append"
+	// QueryModeReplace sends only the query of To.
+	QueryModeReplace QueryMode = "replace"
+	// QueryModeDrop sends no query at all.
+	QueryModeDrop QueryMode = "drop"
+)
+
+type QueryMode string
+
 type Route struct {
 	gorm.Model
-	From string
-	To   string
-	Type RouteType
+	From        string
+	FromMatch   FromMatch `gorm:"default:exact"`
+	To          string
+	Type        RouteType
+	Mode        RouteMode `gorm:"default:source"`
+	Path        string    `gorm:"default:/"`
+	PathMatch   PathMatch `gorm:"default:prefix"`
+	StripPrefix bool
+	Predicates  []Predicate
+	// Priority orders routes matching the same request, the route with the highest priority is used.
+	Priority  int
+	QueryMode QueryMode `gorm:"default:append"`
+	// RedirectCode is the status code of redirect routes.
+	// To of redirect routes can use "{scheme}", "{host}", "{hostname}", "{port}", "{path}", "{rest}" and "{query}"
+	// placeholders filled from the request. If "{path}", "{rest}" or "{query}" is used,
+	// the path and the query of the request are not appended to To automatically.
+	RedirectCode int `gorm:"default:307"`
+	// FlushInterval is how often proxied responses are flushed to the client.
+	// Streaming responses are always flushed immediately. Zero flushes others periodically,
+	// negative flushes after every write.
+	FlushInterval Duration
+	// Targets of proxy routes are used instead of To if there are any.
+	Targets        []Target
+	Balance        Balance `gorm:"default:round-robin"`
+	BalanceHeader  string
+	HealthCheck    HealthCheck    `gorm:"embedded;embeddedPrefix:health_check_"`
+	CircuitBreaker CircuitBreaker `gorm:"embedded;embeddedPrefix:circuit_breaker_"`
+	Retry          Retry          `gorm:"embedded;embeddedPrefix:retry_"`
+	Timeouts       Timeouts       `gorm:"embedded;embeddedPrefix:timeout_"`
+	Pool           Pool           `gorm:"embedded;embeddedPrefix:pool_"`
+	UpstreamTLS    UpstreamTLS    `gorm:"embedded;embeddedPrefix:upstream_tls_"`
+	HTTPS          HTTPS          `gorm:"embedded;embeddedPrefix:https_"`
+	// ACME requests a certificate for From from the ACME certificate authority.
+	// Only available for exact host routes.
+	ACME bool
+	// ListenPort is the port TCP routes accept connections on, every TCP route has its own port.
+	ListenPort int
 }
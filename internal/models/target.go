@@ -0,0 +1,33 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	// BalanceRoundRobin sends requests to targets in turn.
+	BalanceRoundRobin Balance = "round-robin"
+	// BalanceRandom sends every request to a random target.
+	BalanceRandom Balance = "random"
+	// BalanceLeastConnections sends requests to the target with the fewest requests in progress.
+	BalanceLeastConnections Balance = "least-connections"
+	// BalanceHashIP sends all requests from the same client address to the same target.
+	// Only requests of a removed target move to other targets when the list of targets changes.
+	BalanceHashIP Balance = "hash-ip"
+	// BalanceHashHeader is like BalanceHashIP but uses the value of the request header BalanceHeader.
+	// Requests without the header are balanced by the client address.
+	BalanceHashHeader Balance = "hash-header"
+)
+
+type Balance string
+
+// Target is one of the upstreams of a proxy route that requests are balanced between.
+type Target struct {
+	gorm.Model
+	RouteID uint
+	// Address is used like To of a single target route and can contain the same placeholders.
+	Address string
+	// Weight is the share of requests sent to the target relative to other targets of the route.
+	// Zero weight takes the target out of rotation.
+	Weight int `gorm:"default:1"`
+}
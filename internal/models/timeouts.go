@@ -0,0 +1,13 @@
+package models
+
+// Timeouts limit how long requests of a proxy route wait for the target.
+// Dial, TLSHandshake and ResponseHeader limit connecting to the target and waiting for the response headers,
+// Request limits the whole request including the response body. Zero values are replaced with defaults,
+// the whole request isn't limited by default to keep streaming responses working.
+// TCP routes only use Dial.
+type Timeouts struct {
+	Dial           Duration
+	TLSHandshake   Duration
+	ResponseHeader Duration
+	Request        Duration
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+// budgetWindow is the number of seconds the retry budget looks back at.
+const budgetWindow = 10
+
+// retryBudget limits retries of all routes to a share of requests in the last budgetWindow seconds,
+// so a failing upstream doesn't get several times more load from retries.
+// A minimum number of retries per second is always allowed for routes with little traffic.
+type retryBudget struct {
+	ratio        float64
+	minPerSecond int
+	buckets      [budgetWindow]budgetBucket
+	m            sync.Mutex
+}
+
+// budgetBucket counts requests and retries of a single second.
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+func newRetryBudget(ratio float64, minPerSecond int) *retryBudget {
+	return &retryBudget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		buckets:      [budgetWindow]budgetBucket{},
+		m:            sync.Mutex{},
+	}
+}
+
+// request records a request that can be retried.
+func (b *retryBudget) request(now time.Time) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.bucket(now).requests++
+}
+
+// withdraw records a retry and reports whether it fits into the budget.
+func (b *retryBudget) withdraw(now time.Time) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	current := b.bucket(now)
+
+	requests, retries := 0, 0
+
+	for _, bucket := range b.buckets {
+		if now.Unix()-bucket.second < budgetWindow {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	allowed := int(b.ratio * float64(requests))
+	if floor := b.minPerSecond * budgetWindow; allowed < floor {
+		allowed = floor
+	}
+
+	if retries >= allowed {
+		return false
+	}
+
+	current.retries++
+
+	return true
+}
+
+func (b *retryBudget) bucket(now time.Time) *budgetBucket {
+	second := now.Unix()
+
+	bucket := &b.buckets[second%budgetWindow]
+	if bucket.second != second {
+		*bucket = budgetBucket{second: second, requests: 0, retries: 0}
+	}
+
+	return bucket
+}
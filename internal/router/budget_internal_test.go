@@ -0,0 +1,44 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBudget_withdraw(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1000, 0)
+	budget := newRetryBudget(0.5, 0)
+
+	for i := 0; i < 4; i++ {
+		budget.request(now)
+	}
+
+	assert.True(t, budget.withdraw(now))
+	assert.True(t, budget.withdraw(now.Add(time.Second)))
+	assert.False(t, budget.withdraw(now.Add(time.Second)))
+
+	// Requests and retries older than the window are forgotten.
+	later := now.Add((budgetWindow + 1) * time.Second)
+	budget.request(later)
+	budget.request(later)
+
+	assert.True(t, budget.withdraw(later))
+	assert.False(t, budget.withdraw(later))
+}
+
+func TestRetryBudget_withdrawMinimum(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1000, 0)
+	budget := newRetryBudget(0.1, 1)
+
+	for i := 0; i < budgetWindow; i++ {
+		assert.True(t, budget.withdraw(now))
+	}
+
+	assert.False(t, budget.withdraw(now))
+}
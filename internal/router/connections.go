@@ -0,0 +1,149 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/iskorotkov/router/internal/metrics"
+	"github.com/quic-go/quic-go"
+	"golang.org/x/net/http/httpguts"
+)
+
+// http2Proto is the ALPN protocol of HTTP/2 over TLS.
+const http2Proto = "h2"
+
+type connContextKey struct{}
+
+// connTracker counts client connections of a TCP listener per protocol from accepting them until they're closed,
+// including idle ones and ones that never send a request. Connections start as HTTP/1.1 and move to
+// the protocol once it's known: TLS connections negotiate it during the handshake
+// and plain ones switch to h2c with their first request.
+type connTracker struct {
+	metrics   *metrics.Metrics
+	mu        sync.Mutex
+	protocols map[net.Conn]string
+}
+
+func newConnTracker(metrics *metrics.Metrics) *connTracker {
+	return &connTracker{
+		metrics:   metrics,
+		mu:        sync.Mutex{},
+		protocols: make(map[net.Conn]string),
+	}
+}
+
+// track makes the server report its connections, it must be called after the handler is set.
+func (t *connTracker) track(server *http.Server) {
+	next := server.Handler
+
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, connContextKey{}, c)
+	}
+
+	server.ConnState = func(c net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			t.open(c, metrics.ProtocolHTTP1)
+		case http.StateActive, http.StateIdle:
+			// HTTP/2 connections only report these states after the handshake.
+			if tc, ok := c.(*tls.Conn); ok && tc.ConnectionState().NegotiatedProtocol == http2Proto {
+				t.open(c, metrics.ProtocolHTTP2)
+			}
+		case http.StateClosed:
+			t.close(c)
+		case http.StateHijacked:
+			// Upgraded connections are counted separately, h2c ones are closed after the handler returns.
+			if t.protocol(c) != metrics.ProtocolH2C {
+				t.close(c)
+			}
+		}
+	}
+
+	server.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		c, ok := r.Context().Value(connContextKey{}).(net.Conn)
+		if !ok {
+			next.ServeHTTP(rw, r)
+
+			return
+		}
+
+		protocol := requestProtocol(r)
+		t.open(c, protocol)
+
+		if protocol == metrics.ProtocolH2C {
+			// The h2c handler serves the whole connection before returning.
+			defer t.close(c)
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// open records the connection, or moves it to the protocol if it's already known with another one.
+func (t *connTracker) open(c net.Conn, protocol string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, ok := t.protocols[c]
+	if ok && previous == protocol {
+		return
+	}
+
+	t.protocols[c] = protocol
+
+	if ok {
+		t.metrics.ConnectionSwitched(previous, protocol)
+	} else {
+		t.metrics.ConnectionOpened(protocol)
+	}
+}
+
+func (t *connTracker) close(c net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if protocol, ok := t.protocols[c]; ok {
+		delete(t.protocols, c)
+		t.metrics.ConnectionClosed(protocol)
+	}
+}
+
+func (t *connTracker) protocol(c net.Conn) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.protocols[c]
+}
+
+// trackQUIC counts a QUIC connection until it's closed, it's used as ConnContext of HTTP/3 servers.
+func (s Server) trackQUIC(ctx context.Context, c *quic.Conn) context.Context {
+	s.metrics.ConnectionOpened(metrics.ProtocolHTTP3)
+
+	go func() {
+		<-c.Context().Done()
+		s.metrics.ConnectionClosed(metrics.ProtocolHTTP3)
+	}()
+
+	return ctx
+}
+
+// requestProtocol returns the protocol of the connection of a request,
+// h2c requests are recognized the same way as by the h2c handler.
+func requestProtocol(r *http.Request) string {
+	switch {
+	case r.ProtoMajor == 3:
+		return metrics.ProtocolHTTP3
+	case r.ProtoMajor == 2 && r.TLS != nil:
+		return metrics.ProtocolHTTP2
+	case r.Method == "PRI" && r.URL.Path == "*" && r.Proto == "HTTP/2.0":
+		return metrics.ProtocolH2C
+	case httpguts.HeaderValuesContainsToken(r.Header.Values("Upgrade"), "h2c") &&
+		httpguts.HeaderValuesContainsToken(r.Header.Values("Connection"), "HTTP2-Settings"):
+		return metrics.ProtocolH2C
+	default:
+		return metrics.ProtocolHTTP1
+	}
+}
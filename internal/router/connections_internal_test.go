@@ -0,0 +1,246 @@
+package router
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func Test_requestProtocol(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		proto    string
+		method   string
+		target   string
+		header   http.Header
+		tls      bool
+		expected string
+	}{
+		{
+			name:     "http/1.1",
+			proto:    "HTTP/1.1",
+			method:   http.MethodGet,
+			target:   "/",
+			expected: metrics.ProtocolHTTP1,
+		},
+		{
+			name:     "h2 over tls",
+			proto:    "HTTP/2.0",
+			method:   http.MethodGet,
+			target:   "/",
+			tls:      true,
+			expected: metrics.ProtocolHTTP2,
+		},
+		{
+			name:     "h2c with prior knowledge",
+			proto:    "HTTP/2.0",
+			method:   "PRI",
+			target:   "*",
+			expected: metrics.ProtocolH2C,
+		},
+		{
+			name:   "h2c upgrade",
+			proto:  "HTTP/1.1",
+			method: http.MethodGet,
+			target: "/",
+			header: http.Header{
+				"Upgrade":        {"h2c"},
+				"Connection":     {"Upgrade, HTTP2-Settings"},
+				"Http2-Settings": {""},
+			},
+			expected: metrics.ProtocolH2C,
+		},
+		{
+			name:     "websocket upgrade",
+			proto:    "HTTP/1.1",
+			method:   http.MethodGet,
+			target:   "/",
+			header:   http.Header{"Upgrade": {"websocket"}, "Connection": {"Upgrade"}},
+			expected: metrics.ProtocolHTTP1,
+		},
+		{
+			name:     "h3",
+			proto:    "HTTP/3.0",
+			method:   http.MethodGet,
+			target:   "/",
+			tls:      true,
+			expected: metrics.ProtocolHTTP3,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Proto = tt.proto
+			r.ProtoMajor, r.ProtoMinor, _ = http.ParseHTTPVersion(tt.proto)
+
+			for key, values := range tt.header {
+				r.Header[key] = values
+			}
+
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{} //nolint:exhaustivestruct
+			}
+
+			assert.Equal(t, tt.expected, requestProtocol(r))
+		})
+	}
+}
+
+func TestConnTracker_track(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(rw, r.Proto)
+	})
+
+	tests := []struct {
+		name     string
+		tls      bool
+		client   func(server *httptest.Server) *http.Client
+		protocol string
+	}{
+		{
+			name:     "http/1.1",
+			client:   func(*httptest.Server) *http.Client { return &http.Client{Transport: &http.Transport{}} }, //nolint:exhaustivestruct,lll
+			protocol: metrics.ProtocolHTTP1,
+		},
+		{
+			name:     "h2c",
+			client:   func(*httptest.Server) *http.Client { return newH2CClient() },
+			protocol: metrics.ProtocolH2C,
+		},
+		{
+			name:     "h2",
+			tls:      true,
+			client:   (*httptest.Server).Client,
+			protocol: metrics.ProtocolHTTP2,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := metrics.New()
+
+			server := httptest.NewUnstartedServer(h2c.NewHandler(handler, &http2.Server{})) //nolint:exhaustivestruct
+			server.EnableHTTP2 = true
+			newConnTracker(m).track(server.Config)
+
+			if tt.tls {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+
+			t.Cleanup(server.Close)
+
+			client := tt.client(server)
+
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(server.URL) //nolint:noctx
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+
+			// Both requests are sent over the same connection.
+			for protocol, counts := range m.Snapshot().Connections {
+				if protocol == tt.protocol {
+					assert.Equal(t, metrics.ConnectionCounts{Open: 1, Total: 1}, counts, protocol)
+				} else {
+					assert.Zero(t, counts.Total, protocol)
+				}
+			}
+
+			client.CloseIdleConnections()
+
+			assert.Eventually(t, func() bool {
+				return m.Snapshot().Connections[tt.protocol].Open == 0
+			}, 5*time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestConnTracker_trackWithoutRequests(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		tls  bool
+	}{
+		{name: "plain", tls: false},
+		{name: "tls handshake", tls: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := metrics.New()
+
+			server := httptest.NewUnstartedServer(http.NotFoundHandler())
+			newConnTracker(m).track(server.Config)
+
+			if tt.tls {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+
+			t.Cleanup(server.Close)
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.tls {
+				config := server.Client().Transport.(*http.Transport).TLSClientConfig.Clone() //nolint:forcetypeassert
+				config.ServerName = "example.com"
+
+				tlsConn := tls.Client(conn, config)
+				if err := tlsConn.Handshake(); err != nil {
+					t.Fatal(err)
+				}
+
+				conn = tlsConn
+			}
+
+			// The connection is counted before it sends a request.
+			assert.Eventually(t, func() bool {
+				return m.Snapshot().Connections[metrics.ProtocolHTTP1] == metrics.ConnectionCounts{Open: 1, Total: 1}
+			}, 5*time.Second, 10*time.Millisecond)
+
+			_ = conn.Close()
+
+			assert.Eventually(t, func() bool {
+				return m.Snapshot().Connections[metrics.ProtocolHTTP1] == metrics.ConnectionCounts{Open: 0, Total: 1}
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
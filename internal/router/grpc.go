@@ -0,0 +1,117 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	grpcContentType   = "application/grpc"
+	grpcTimeoutHeader = "Grpc-Timeout"
+	// grpcMaxTimeout is the largest value of Grpc-Timeout, it has at most 8 digits.
+	grpcMaxTimeout = 99999999
+)
+
+// Status codes of gRPC returned when a call can't be proxied.
+const (
+	grpcDeadlineExceeded = 4
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+)
+
+//nolint:gochecknoglobals
+var (
+	// grpcTimeoutUnits are units of Grpc-Timeout from the smallest to the largest.
+	grpcTimeoutUnits = []struct {
+		suffix byte
+		unit   time.Duration
+	}{
+		{suffix: 'n', unit: time.Nanosecond},
+		{suffix: 'u', unit: time.Microsecond},
+		{suffix: 'm', unit: time.Millisecond},
+		{suffix: 'S', unit: time.Second},
+		{suffix: 'M', unit: time.Minute},
+		{suffix: 'H', unit: time.Hour},
+	}
+)
+
+// isGRPC reports whether the request is a gRPC call.
+func isGRPC(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+
+	return contentType == grpcContentType ||
+		strings.HasPrefix(contentType, grpcContentType+"+") ||
+		strings.HasPrefix(contentType, grpcContentType+";")
+}
+
+// grpcTimeout parses the deadline the client set for the call.
+func grpcTimeout(r *http.Request) (time.Duration, bool) {
+	value := r.Header.Get(grpcTimeoutHeader)
+	if len(value) < 2 {
+		return 0, false
+	}
+
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || amount < 0 || amount > grpcMaxTimeout {
+		return 0, false
+	}
+
+	for _, unit := range grpcTimeoutUnits {
+		if unit.suffix == value[len(value)-1] {
+			if amount > int64(1<<63-1)/int64(unit.unit) {
+				return 0, false
+			}
+
+			return time.Duration(amount) * unit.unit, true
+		}
+	}
+
+	return 0, false
+}
+
+// setGRPCTimeout sets Grpc-Timeout of the outgoing call to the time left until its deadline,
+// so the target stops working on the call when the client or the route gives up on it.
+func setGRPCTimeout(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+
+	req.Header.Set(grpcTimeoutHeader, encodeGRPCTimeout(time.Until(deadline)))
+}
+
+// encodeGRPCTimeout formats the timeout with the smallest unit that fits, rounding it up.
+func encodeGRPCTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "1n"
+	}
+
+	for _, unit := range grpcTimeoutUnits {
+		if amount := (timeout + unit.unit - 1) / unit.unit; amount <= grpcMaxTimeout {
+			return fmt.Sprintf("%d%c", amount, unit.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%dH", grpcMaxTimeout)
+}
+
+// writeGRPCError responds to a gRPC call that couldn't be proxied with a status of gRPC instead of an HTTP one.
+// The response has no body, as the one of a gRPC server failing the call right away.
+func writeGRPCError(rw http.ResponseWriter, status int) {
+	code := grpcUnavailable
+
+	switch status {
+	case http.StatusGatewayTimeout:
+		code = grpcDeadlineExceeded
+	case http.StatusInternalServerError:
+		code = grpcInternal
+	}
+
+	rw.Header().Set("Content-Type", grpcContentType)
+	rw.Header().Set("Grpc-Status", strconv.Itoa(code))
+	rw.Header().Set("Grpc-Message", http.StatusText(status))
+	rw.WriteHeader(http.StatusOK)
+}
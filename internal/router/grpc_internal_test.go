@@ -0,0 +1,232 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func Test_grpcTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		timeout time.Duration
+		ok      bool
+	}{
+		{value: "", ok: false},
+		{value: "100m", timeout: 100 * time.Millisecond, ok: true},
+		{value: "2S", timeout: 2 * time.Second, ok: true},
+		{value: "1H", timeout: time.Hour, ok: true},
+		{value: "5n", timeout: 5, ok: true},
+		{value: "10", ok: false},
+		{value: "m", ok: false},
+		{value: "-1S", ok: false},
+		{value: "123456789S", ok: false},
+		{value: "99999999H", ok: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "http://example.com/", nil)
+			r.Header.Set(grpcTimeoutHeader, tt.value)
+
+			timeout, ok := grpcTimeout(r)
+
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.timeout, timeout)
+		})
+	}
+}
+
+func Test_encodeGRPCTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		timeout time.Duration
+		value   string
+	}{
+		{timeout: -time.Second, value: "1n"},
+		{timeout: 1500 * time.Millisecond, value: "1500000u"},
+		{timeout: 99 * time.Millisecond, value: "99000000n"},
+		{timeout: time.Hour, value: "3600000m"},
+		{timeout: 1000 * time.Hour, value: "3600000S"},
+		{timeout: 100000 * time.Hour, value: "6000000M"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.value, encodeGRPCTimeout(tt.timeout))
+		})
+	}
+}
+
+// newH2CClient returns a client speaking HTTP/2 over plain connections.
+func newH2CClient() *http.Client {
+	return &http.Client{ //nolint:exhaustivestruct
+		Transport: &http2.Transport{ //nolint:exhaustivestruct
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+//nolint:funlen
+func TestServer_applyRouteGRPC(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			rw.WriteHeader(http.StatusHTTPVersionNotSupported)
+
+			return
+		}
+
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+
+			return
+		}
+
+		rw.Header().Set("Content-Type", grpcContentType)
+		rw.Header().Set("Trailer", "Grpc-Status, X-Timeout")
+		rw.WriteHeader(http.StatusOK)
+		rw.(http.Flusher).Flush()
+
+		// Every line of the request is sent back right away, so the call is a bidirectional stream.
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			_, _ = fmt.Fprintln(rw, scanner.Text())
+			rw.(http.Flusher).Flush()
+		}
+
+		rw.Header().Set("Grpc-Status", "0")
+		rw.Header().Set("X-Timeout", r.Header.Get(grpcTimeoutHeader))
+	}), &http2.Server{})) //nolint:exhaustivestruct
+	t.Cleanup(upstream.Close)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	newRouter := func(t *testing.T, target string) string {
+		t.Helper()
+
+		s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+			From: "127.0.0.1",
+			To:   target,
+			Pool: models.Pool{H2C: true}, //nolint:exhaustivestruct
+		}, Config{}) //nolint:exhaustivestruct
+
+		router := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(s.applyRoute), &http2.Server{})) //nolint:exhaustivestruct
+		t.Cleanup(router.Close)
+
+		return router.URL
+	}
+
+	t.Run("stream with trailers", func(t *testing.T) {
+		t.Parallel()
+
+		url := newRouter(t, upstream.Listener.Addr().String())
+		body, requests := io.Pipe()
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url+"/echo", body)
+		assert.NoError(t, err)
+
+		req.Header.Set("Content-Type", grpcContentType)
+		req.Header.Set(grpcTimeoutHeader, "10S")
+
+		resp, err := newH2CClient().Do(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+
+		responses := bufio.NewReader(resp.Body)
+
+		for _, message := range []string{"first", "second"} {
+			_, _ = fmt.Fprintln(requests, message)
+
+			line, err := responses.ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, message+"\n", line)
+		}
+
+		_ = requests.Close()
+
+		rest, err := io.ReadAll(responses)
+		assert.NoError(t, err)
+		assert.Empty(t, rest)
+
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+
+		// The target gets the time left until the deadline.
+		sent := httptest.NewRequest(http.MethodPost, "http://example.com/", nil)
+		sent.Header.Set(grpcTimeoutHeader, resp.Trailer.Get("X-Timeout"))
+
+		timeout, ok := grpcTimeout(sent)
+		assert.True(t, ok)
+		assert.InDelta(t, 10*time.Second, timeout, float64(time.Second))
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		path   string
+		status string
+	}{
+		{name: "unavailable target", target: closed.Listener.Addr().String(), path: "/", status: "14"},
+		{name: "deadline exceeded", target: upstream.Listener.Addr().String(), path: "/slow", status: "4"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			url := newRouter(t, tt.target)
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url+tt.path, nil)
+			assert.NoError(t, err)
+
+			req.Header.Set("Content-Type", grpcContentType)
+			req.Header.Set(grpcTimeoutHeader, "100m")
+
+			resp, err := newH2CClient().Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			_ = resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, grpcContentType, resp.Header.Get("Content-Type"))
+			assert.Equal(t, tt.status, resp.Header.Get("Grpc-Status"))
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package router
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	altSvcHeader = "Alt-Svc"
+	// altSvcMaxAge is how long clients remember that HTTP/3 is available.
+	altSvcMaxAge = 24 * time.Hour
+)
+
+// altSvcValue advertises HTTP/3 on the port of the same host.
+func altSvcValue(port int) string {
+	return fmt.Sprintf(`h3=":%d"; ma=%d`, port, int64(altSvcMaxAge.Seconds()))
+}
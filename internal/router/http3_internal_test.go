@@ -0,0 +1,192 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/certs"
+	"github.com/iskorotkov/router/internal/metrics"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestServer_applyRouteAltSvc(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set(altSvcHeader, `h3=":9443"`)
+	}))
+	t.Cleanup(upstream.Close)
+
+	tests := []struct {
+		name   string
+		port   int
+		tls    bool
+		altSvc string
+	}{
+		{
+			name:   "http3 over tls",
+			port:   8443,
+			tls:    true,
+			altSvc: `h3=":8443"; ma=86400`,
+		},
+		{
+			name:   "no http3 over plain http",
+			port:   8443,
+			altSvc: "",
+		},
+		{
+			name:   "http3 disabled",
+			tls:    true,
+			altSvc: `h3=":9443"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+				To:          upstream.Listener.Addr().String(),
+				UpstreamTLS: models.UpstreamTLS{Scheme: "http"}, //nolint:exhaustivestruct
+			}, Config{HTTP3Port: tt.port}) //nolint:exhaustivestruct
+
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{ServerName: "example.com"} //nolint:exhaustivestruct
+			}
+
+			rw := httptest.NewRecorder()
+			s.applyRoute(rw, r)
+
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, tt.altSvc, rw.Header().Get(altSvcHeader))
+		})
+	}
+}
+
+// freeUDPPort returns a port that was free a moment ago.
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port //nolint:forcetypeassert
+}
+
+//nolint:funlen
+func TestServer_ListenAndServeHTTP3(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(rw, "ok")
+	}))
+	t.Cleanup(upstream.Close)
+
+	// The certificate of a test server is valid for example.com, so the router reuses it.
+	issuer := httptest.NewTLSServer(http.NotFoundHandler())
+	issuer.Close()
+
+	chain := issuer.TLS.Certificates[0]
+
+	key, err := x509.MarshalPKCS8PrivateKey(chain.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := certs.Parse(models.Certificate{ //nolint:exhaustivestruct
+		Name:        "example",
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain.Certificate[0]})), //nolint:exhaustivestruct
+		Key:         string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})),                  //nolint:exhaustivestruct
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificates := newCertificates()
+	certificates.Set(parsed)
+
+	routes := routing.New()
+	routes.Set(routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+		Model:       gorm.Model{ID: 1}, //nolint:exhaustivestruct
+		From:        "example.com",
+		Mode:        models.RouteModeHost,
+		To:          upstream.Listener.Addr().String(),
+		Type:        models.RouteTypeProxy,
+		UpstreamTLS: models.UpstreamTLS{Scheme: "http"}, //nolint:exhaustivestruct
+	}))
+
+	s := NewServer(&routes, certificates, nil, metrics.New(), Config{}) //nolint:exhaustivestruct
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	port := freeUDPPort(t)
+
+	go s.ListenAndServeHTTP3(ctx, port)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(issuer.Certificate())
+
+	transport := &http3.Transport{ //nolint:exhaustivestruct
+		TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "example.com", MinVersion: tls.VersionTLS13}, //nolint:exhaustivestruct,lll
+	}
+	client := &http.Client{Transport: transport} //nolint:exhaustivestruct
+
+	var body string
+
+	assert.Eventually(t, func() bool {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://127.0.0.1:%d/", port), nil)
+		if err != nil {
+			return false
+		}
+
+		r.Host = "example.com"
+
+		resp, err := client.Do(r)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false
+		}
+
+		body = string(b)
+
+		return resp.ProtoMajor == 3
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, "ok", body)
+	assert.Equal(t, metrics.ConnectionCounts{Open: 1, Total: 1},
+		s.metrics.Snapshot().Connections[metrics.ProtocolHTTP3])
+
+	if err := transport.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Eventually(t, func() bool {
+		return s.metrics.Snapshot().Connections[metrics.ProtocolHTTP3].Open == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
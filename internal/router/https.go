@@ -0,0 +1,51 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+const (
+	hstsHeader = "Strict-Transport-Security"
+	// defaultHTTPSPort is omitted from URLs of redirects to HTTPS.
+	defaultHTTPSPort = 443
+)
+
+// httpsURL is the URL of the request over HTTPS with the same host, path and query.
+// Zero port is the same as the default one.
+func httpsURL(r *http.Request, port int) *url.URL {
+	host := (&url.URL{Host: r.Host}).Hostname() //nolint:exhaustivestruct
+	if port != 0 && port != defaultHTTPSPort {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	} else if strings.Contains(host, ":") {
+		host = fmt.Sprintf("[%s]", host)
+	}
+
+	target := *r.URL
+	target.Scheme = "https"
+	target.Host = host
+
+	return &target
+}
+
+// hstsValue builds Strict-Transport-Security of the route.
+func hstsValue(settings models.HTTPS) string {
+	value := fmt.Sprintf("max-age=%d", int64(time.Duration(settings.HSTSMaxAge)/time.Second))
+
+	if settings.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+
+	if settings.HSTSPreload {
+		value += "; preload"
+	}
+
+	return value
+}
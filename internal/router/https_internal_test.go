@@ -0,0 +1,120 @@
+package router
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:funlen
+func TestServer_applyRouteHTTPS(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set(hstsHeader, "max-age=60")
+		_, _ = fmt.Fprint(rw, "ok")
+	}))
+	t.Cleanup(upstream.Close)
+
+	hsts := models.HTTPS{ //nolint:exhaustivestruct
+		Redirect:              true,
+		HSTSMaxAge:            models.Duration(365 * 24 * time.Hour),
+		HSTSIncludeSubdomains: true,
+		HSTSPreload:           true,
+	}
+
+	tests := []struct {
+		name     string
+		https    models.HTTPS
+		port     int
+		url      string
+		tls      bool
+		code     int
+		location string
+		hsts     string
+	}{
+		{
+			name:     "redirect keeps path and query",
+			https:    models.HTTPS{Redirect: true}, //nolint:exhaustivestruct
+			url:      "http://example.com/a/b?c=d",
+			code:     http.StatusPermanentRedirect,
+			location: "https://example.com/a/b?c=d",
+		},
+		{
+			name:     "redirect to tls port",
+			https:    models.HTTPS{Redirect: true}, //nolint:exhaustivestruct
+			port:     8443,
+			url:      "http://example.com:8080/a",
+			code:     http.StatusPermanentRedirect,
+			location: "https://example.com:8443/a",
+		},
+		{
+			name:     "redirect omits default port",
+			https:    models.HTTPS{Redirect: true}, //nolint:exhaustivestruct
+			port:     443,
+			url:      "http://example.com:8080/a",
+			code:     http.StatusPermanentRedirect,
+			location: "https://example.com/a",
+		},
+		{
+			name:  "acme challenge isn't redirected",
+			https: models.HTTPS{Redirect: true}, //nolint:exhaustivestruct
+			url:   "http://example.com/.well-known/acme-challenge/token",
+			code:  http.StatusOK,
+			hsts:  "max-age=60",
+		},
+		{
+			name: "no redirect",
+			url:  "http://example.com/a",
+			code: http.StatusOK,
+			hsts: "max-age=60",
+		},
+		{
+			name:  "hsts replaces policy of target",
+			https: hsts,
+			url:   "https://example.com/a",
+			tls:   true,
+			code:  http.StatusOK,
+			hsts:  "max-age=31536000; includeSubDomains; preload",
+		},
+		{
+			name:  "no hsts over plain http",
+			https: models.HTTPS{HSTSMaxAge: models.Duration(time.Hour)}, //nolint:exhaustivestruct
+			url:   "http://example.com/a",
+			code:  http.StatusOK,
+			hsts:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+				To:          upstream.Listener.Addr().String(),
+				HTTPS:       tt.https,
+				UpstreamTLS: models.UpstreamTLS{Scheme: "http"}, //nolint:exhaustivestruct
+			}, Config{HTTPSPort: tt.port}) //nolint:exhaustivestruct
+
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{ServerName: "example.com"} //nolint:exhaustivestruct
+			}
+
+			rw := httptest.NewRecorder()
+			s.applyRoute(rw, r)
+
+			assert.Equal(t, tt.code, rw.Code)
+			assert.Equal(t, tt.location, rw.Header().Get("Location"))
+			assert.Equal(t, tt.hsts, rw.Header().Get(hstsHeader))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+// defaultFlushInterval is how often buffered response bodies are flushed to the client
+// if the route doesn't set its own interval. httputil.ReverseProxy flushes streaming responses immediately.
+const defaultFlushInterval = 100 * time.Millisecond
+
+// proxyRequest forwards the request to a target of the route and copies the response back.
+// Hop-by-hop headers are removed in both directions, and X-Forwarded-For is extended with the client address.
+// The upstream request is canceled when the client goes away.
+// Protocol upgrades (e.g. WebSocket) are streamed in both directions until one side closes the connection
+// or it stays idle longer than Config.UpgradeIdleTimeout.
+// Failed requests are retried on other targets if the route has a retry policy, see upstreamTransport.
+// Requests exceeding timeouts of the route get 504 if the response hasn't started yet.
+// Targets without a scheme use the scheme of the incoming request unless the route sets its own.
+// gRPC calls keep their trailers and streams, get deadlines from Grpc-Timeout and get gRPC statuses on failures.
+func (s Server) proxyRequest(rw http.ResponseWriter, r *http.Request, schema string, match routing.Match) {
+	info := match.Route
+
+	if info.UpstreamTLS.Scheme != "" {
+		schema = info.UpstreamTLS.Scheme
+	}
+
+	if info.Pool.H2C {
+		// h2c targets are reached over plain connections whatever the scheme of the request is.
+		schema = "http"
+	}
+
+	if info.Timeouts.Request != 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(info.Timeouts.Request))
+		defer cancel()
+
+		r = r.WithContext(ctx)
+	}
+
+	grpc := isGRPC(r)
+
+	if timeout, ok := grpcTimeout(r); ok && grpc {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		r = r.WithContext(ctx)
+	}
+
+	flushInterval := time.Duration(info.FlushInterval)
+	if flushInterval == 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	transport := &upstreamTransport{
+		transports: s.transports,
+		schema:     schema,
+		match:      match,
+		incoming:   r.URL,
+		budget:     s.budget,
+		metrics:    s.metrics,
+		bufferSize: s.config.RetryBufferSize,
+		current:    nil,
+	}
+	defer transport.done()
+
+	proxy := &httputil.ReverseProxy{ //nolint:exhaustivestruct
+		Director: func(req *http.Request) {
+			setForwardedHeaders(req)
+
+			if grpc {
+				setGRPCTimeout(req)
+			}
+		},
+		Transport:     transport,
+		FlushInterval: flushInterval,
+		ErrorHandler:  handleProxyError,
+	}
+
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if info.HTTPS.HSTSMaxAge != 0 {
+			// The policy of the route replaces the one of the target.
+			resp.Header.Del(hstsHeader)
+		}
+
+		if s.config.HTTP3Port != 0 {
+			// Alternative services of the target aren't reachable through the router.
+			resp.Header.Del(altSvcHeader)
+		}
+
+		if isUpgradeResponse(resp) {
+			return trackUpgrade(resp, s.metrics, s.config.UpgradeIdleTimeout)
+		}
+
+		return nil
+	}
+
+	proxy.ServeHTTP(rw, r)
+}
+
+// setForwardedHeaders sets X-Forwarded-Host and X-Forwarded-Proto of the outgoing request.
+func setForwardedHeaders(req *http.Request) {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	req.Header.Set("X-Forwarded-Proto", proto)
+}
+
+// setTarget points the outgoing request to the target.
+func setTarget(req *http.Request, target *url.URL) {
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = target.Path
+	req.URL.RawPath = target.RawPath
+	req.URL.RawQuery = target.RawQuery
+	req.Host = target.Host
+}
+
+// handleProxyError responds with 503 if the route has no available targets, with 504 if the upstream timed out
+// and with 502 if it failed otherwise. gRPC calls get corresponding gRPC statuses instead.
+func handleProxyError(rw http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		log.Printf("client canceled request to %q: %v", r.URL, err)
+
+		return
+	case errors.Is(err, ErrNoTarget):
+		log.Printf("error proxying request to %q: %v", r.URL, err)
+
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, ErrInvalidTarget):
+		log.Printf("error building target url for %q: %v", r.URL, err)
+
+		status = http.StatusInternalServerError
+	case isTimeout(err):
+		log.Printf("upstream timed out for %q: %v", r.URL, err)
+
+		status = http.StatusGatewayTimeout
+	default:
+		log.Printf("error proxying request to %q: %v", r.URL, err)
+	}
+
+	if isGRPC(r) {
+		writeGRPCError(rw, status)
+
+		return
+	}
+
+	rw.WriteHeader(status)
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
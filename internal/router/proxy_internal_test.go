@@ -0,0 +1,556 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/certs"
+	"github.com/iskorotkov/router/internal/metrics"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// newProxyServer returns a router server proxying requests for example.com to the target.
+func newProxyServer(t *testing.T, target string) Server {
+	t.Helper()
+
+	return newRouteServer(t, models.Route{To: target}, Config{}) //nolint:exhaustivestruct
+}
+
+// newRouteServer returns a router server with a single route, by default proxying requests for example.com.
+func newRouteServer(t *testing.T, route models.Route, config Config) Server {
+	t.Helper()
+
+	route.ID = 1
+
+	if route.From == "" {
+		route.From = "example.com"
+		route.Mode = models.RouteModeHost
+	}
+
+	if route.Type == "" {
+		route.Type = models.RouteTypeProxy
+	}
+
+	routes := routing.New()
+	routes.Set(routing.NewRouteInfo(route))
+
+	return NewServer(&routes, newCertificates(), nil, metrics.New(), config)
+}
+
+func newCertificates() *certs.Store {
+	store := certs.New()
+
+	return &store
+}
+
+func upstreamAddress(t *testing.T, upstream *httptest.Server) string {
+	t.Helper()
+
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Host
+}
+
+func TestServer_applyRouteProxyHeaders(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "example.com", r.Header.Get("X-Forwarded-Host"))
+		assert.Equal(t, "http", r.Header.Get("X-Forwarded-Proto"))
+		assert.Equal(t, "10.0.0.1, 192.0.2.1", r.Header.Get("X-Forwarded-For"))
+		assert.Empty(t, r.Header.Get("X-Hop"))
+		assert.Empty(t, r.Header.Get("Keep-Alive"))
+		assert.Equal(t, "value", r.Header.Get("X-End-To-End"))
+
+		rw.Header().Set("Connection", "X-Upstream-Hop")
+		rw.Header().Set("X-Upstream-Hop", "value")
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	r.Header.Set("Connection", "X-Hop")
+	r.Header.Set("X-Hop", "value")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("X-End-To-End", "value")
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	rw := httptest.NewRecorder()
+
+	newProxyServer(t, upstreamAddress(t, upstream)).applyRoute(rw, r)
+
+	assert.Equal(t, http.StatusAccepted, rw.Code)
+	assert.Empty(t, rw.Header().Get("X-Upstream-Hop"))
+}
+
+func TestServer_applyRouteProxyUnavailable(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+	_ = l.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	rw := httptest.NewRecorder()
+
+	newProxyServer(t, address).applyRoute(rw, r)
+
+	assert.Equal(t, http.StatusBadGateway, rw.Code)
+}
+
+//nolint:funlen
+func TestServer_applyRouteProxyStreaming(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		contentType   string
+		contentLength bool
+		flushInterval models.Duration
+	}{
+		{
+			name:          "server-sent events",
+			contentType:   "text/event-stream; charset=utf-8",
+			contentLength: true,
+			flushInterval: 0,
+		},
+		{
+			name:          "chunked",
+			contentType:   "application/json",
+			contentLength: false,
+			flushInterval: 0,
+		},
+		{
+			name:          "route flush interval",
+			contentType:   "application/octet-stream",
+			contentLength: true,
+			flushInterval: models.Duration(10 * time.Millisecond),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			release := make(chan struct{})
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.Header().Set("Content-Type", tt.contentType)
+
+				if tt.contentLength {
+					rw.Header().Set("Content-Length", "1024")
+				}
+
+				_, _ = fmt.Fprint(rw, "data: first\n\n")
+				rw.(http.Flusher).Flush()
+
+				// The rest of the body is only sent after the client got the first part.
+				<-release
+			}))
+			defer upstream.Close()
+
+			s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+				To:            upstreamAddress(t, upstream),
+				FlushInterval: tt.flushInterval,
+			}, Config{}) //nolint:exhaustivestruct
+
+			router := httptest.NewServer(http.HandlerFunc(s.applyRoute))
+			defer router.Close()
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, router.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Host = "example.com"
+
+			resp, err := router.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			defer close(release)
+
+			line := make(chan string, 1)
+
+			go func() {
+				s, _ := bufio.NewReader(resp.Body).ReadString('\n')
+				line <- s
+			}()
+
+			select {
+			case s := <-line:
+				assert.Equal(t, "data: first\n", s)
+			case <-time.After(time.Second):
+				t.Error("first part of the response was not flushed")
+			}
+		})
+	}
+}
+
+func TestServer_applyRouteProxyTargets(t *testing.T) {
+	t.Parallel()
+
+	var route models.Route //nolint:exhaustivestruct
+
+	for _, name := range []string{"first", "second"} {
+		name := name
+
+		upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(rw, name)
+		}))
+		defer upstream.Close()
+
+		route.Targets = append(route.Targets, models.Target{Address: upstreamAddress(t, upstream), Weight: 1}) //nolint:exhaustivestruct
+	}
+
+	s := newRouteServer(t, route, Config{}) //nolint:exhaustivestruct
+
+	var got []string
+
+	for i := 0; i < 4; i++ {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		rw := httptest.NewRecorder()
+
+		s.applyRoute(rw, r)
+
+		got = append(got, rw.Body.String())
+	}
+
+	assert.Equal(t, []string{"first", "second", "first", "second"}, got)
+}
+
+func TestServer_applyRouteProxyCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var requests int64
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+		To:             upstreamAddress(t, upstream),
+		CircuitBreaker: models.CircuitBreaker{Failures: 2}, //nolint:exhaustivestruct
+	}, Config{}) //nolint:exhaustivestruct
+
+	var codes []int
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		rw := httptest.NewRecorder()
+
+		s.applyRoute(rw, r)
+
+		codes = append(codes, rw.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusServiceUnavailable}, codes)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&requests))
+}
+
+//nolint:funlen
+func TestServer_applyRouteProxyRetry(t *testing.T) {
+	t.Parallel()
+
+	config := Config{ //nolint:exhaustivestruct
+		RetryBudget:     1,
+		RetryBudgetMin:  10,
+		RetryBufferSize: 1 << 10,
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		body          string
+		nonIdempotent bool
+		config        Config
+		wantCode      int
+		wantBody      string
+		wantRetries   int64
+	}{
+		{
+			name:        "get is retried on another target",
+			method:      http.MethodGet,
+			config:      config,
+			wantCode:    http.StatusOK,
+			wantBody:    "second ",
+			wantRetries: 1,
+		},
+		{
+			name:     "post is not retried",
+			method:   http.MethodPost,
+			body:     "payload",
+			config:   config,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "first",
+		},
+		{
+			name:          "post is retried with the same body if enabled",
+			method:        http.MethodPost,
+			body:          "payload",
+			nonIdempotent: true,
+			config:        config,
+			wantCode:      http.StatusOK,
+			wantBody:      "second payload",
+			wantRetries:   1,
+		},
+		{
+			name:          "large body is not retried",
+			method:        http.MethodPost,
+			body:          "payload",
+			nonIdempotent: true,
+			config:        Config{RetryBudget: 1, RetryBudgetMin: 10, RetryBufferSize: 4}, //nolint:exhaustivestruct
+			wantCode:      http.StatusServiceUnavailable,
+			wantBody:      "first",
+		},
+		{
+			name:     "exhausted budget denies retries",
+			method:   http.MethodGet,
+			config:   Config{}, //nolint:exhaustivestruct
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "first",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			first := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = fmt.Fprint(rw, "first")
+			}))
+			t.Cleanup(first.Close)
+
+			second := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				_, _ = fmt.Fprintf(rw, "second %s", body)
+			}))
+			t.Cleanup(second.Close)
+
+			s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+				Targets: []models.Target{
+					{Address: upstreamAddress(t, first), Weight: 1},  //nolint:exhaustivestruct
+					{Address: upstreamAddress(t, second), Weight: 1}, //nolint:exhaustivestruct
+				},
+				Retry: models.Retry{Attempts: 2, NonIdempotent: tt.nonIdempotent}, //nolint:exhaustivestruct
+			}, tt.config)
+
+			r := httptest.NewRequest(tt.method, "http://example.com/", strings.NewReader(tt.body))
+			rw := httptest.NewRecorder()
+
+			s.applyRoute(rw, r)
+
+			assert.Equal(t, tt.wantCode, rw.Code)
+			assert.Equal(t, tt.wantBody, rw.Body.String())
+			assert.Equal(t, tt.wantRetries, s.metrics.Snapshot().Retries)
+		})
+	}
+}
+
+func TestServer_applyRouteProxyTimeouts(t *testing.T) {
+	t.Parallel()
+
+	const delay = 200 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		timeouts models.Timeouts
+		wantCode int
+	}{
+		{
+			name:     "in time",
+			timeouts: models.Timeouts{Request: models.Duration(time.Second)}, //nolint:exhaustivestruct
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "response header timeout",
+			timeouts: models.Timeouts{ResponseHeader: models.Duration(delay / 4)}, //nolint:exhaustivestruct
+			wantCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:     "request timeout",
+			timeouts: models.Timeouts{Request: models.Duration(delay / 4)}, //nolint:exhaustivestruct
+			wantCode: http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+				}
+			}))
+			t.Cleanup(upstream.Close)
+
+			s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+				To:       upstreamAddress(t, upstream),
+				Timeouts: tt.timeouts,
+			}, Config{}) //nolint:exhaustivestruct
+
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			rw := httptest.NewRecorder()
+
+			start := time.Now()
+
+			s.applyRoute(rw, r)
+
+			assert.Equal(t, tt.wantCode, rw.Code)
+
+			if tt.wantCode == http.StatusGatewayTimeout {
+				assert.Less(t, time.Since(start), delay)
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func TestServer_applyRouteProxyUpstreamTLS(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) != 0 {
+			_, _ = fmt.Fprint(rw, "client certificate")
+		}
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequestClientCert} //nolint:exhaustivestruct,gosec
+	upstream.StartTLS()
+	t.Cleanup(upstream.Close)
+
+	// The certificate of the test server is self-signed, so it's both the CA and the client certificate.
+	chain := upstream.TLS.Certificates[0]
+
+	key, err := x509.MarshalPKCS8PrivateKey(chain.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificates := newCertificates()
+
+	for i, model := range []models.Certificate{
+		{ //nolint:exhaustivestruct
+			Name:        "ca",
+			Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain.Certificate[0]})), //nolint:exhaustivestruct
+		},
+		{ //nolint:exhaustivestruct
+			Name:        "client",
+			Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain.Certificate[0]})), //nolint:exhaustivestruct
+			Key:         string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})),                  //nolint:exhaustivestruct
+		},
+	} {
+		model.ID = uint(i + 1)
+
+		parsed, err := certs.Parse(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certificates.Set(parsed)
+	}
+
+	tests := []struct {
+		name     string
+		settings models.UpstreamTLS
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "plain http to https target",
+			settings: models.UpstreamTLS{}, //nolint:exhaustivestruct
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unknown ca",
+			settings: models.UpstreamTLS{Scheme: "https"}, //nolint:exhaustivestruct
+			wantCode: http.StatusBadGateway,
+		},
+		{
+			name:     "custom ca",
+			settings: models.UpstreamTLS{Scheme: "https", CA: "ca"}, //nolint:exhaustivestruct
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "insecure",
+			settings: models.UpstreamTLS{Scheme: "https", InsecureSkipVerify: true}, //nolint:exhaustivestruct
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "server name override",
+			settings: models.UpstreamTLS{Scheme: "https", CA: "ca", ServerName: "example.org"}, //nolint:exhaustivestruct
+			wantCode: http.StatusBadGateway,
+		},
+		{
+			name:     "client certificate",
+			settings: models.UpstreamTLS{Scheme: "https", CA: "ca", ClientCertificate: "client"}, //nolint:exhaustivestruct
+			wantCode: http.StatusOK,
+			wantBody: "client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			routes := routing.New()
+			routes.Set(routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+				Model:       gorm.Model{ID: 1}, //nolint:exhaustivestruct
+				From:        "example.com",
+				Mode:        models.RouteModeHost,
+				To:          upstreamAddress(t, upstream),
+				Type:        models.RouteTypeProxy,
+				UpstreamTLS: tt.settings,
+			}))
+
+			s := NewServer(&routes, certificates, nil, metrics.New(), Config{}) //nolint:exhaustivestruct
+
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			rw := httptest.NewRecorder()
+
+			s.applyRoute(rw, r)
+
+			assert.Equal(t, tt.wantCode, rw.Code)
+
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rw.Body.String())
+			}
+		})
+	}
+}
@@ -2,33 +2,90 @@ package router
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
+	"github.com/iskorotkov/router/internal/acme"
+	"github.com/iskorotkov/router/internal/certs"
+	"github.com/iskorotkov/router/internal/metrics"
 	"github.com/iskorotkov/router/internal/models"
 	"github.com/iskorotkov/router/internal/routing"
+	"github.com/quic-go/quic-go/http3"
+	acmeclient "golang.org/x/crypto/acme"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+// Config contains settings of the router server.
+type Config struct {
+	// UpgradeIdleTimeout closes upgraded connections without traffic in both directions, zero disables it.
+	UpgradeIdleTimeout time.Duration
+	// RetryBudget is the share of requests that can be retried, counted over the last 10 seconds.
+	RetryBudget float64
+	// RetryBudgetMin is the number of retries per second allowed regardless of RetryBudget.
+	RetryBudgetMin int
+	// RetryBufferSize is the largest request body buffered for retries, requests with larger bodies aren't retried.
+	RetryBufferSize int64
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are timeouts of client connections,
+	// see http.Server. Zero disables a timeout.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// HTTPSPort is the port of URLs in redirects to HTTPS, zero and 443 aren't added to URLs.
+	HTTPSPort int
+	// HTTP3Port is the UDP port of HTTP/3 advertised to clients over TLS with Alt-Svc headers,
+	// zero doesn't advertise HTTP/3.
+	HTTP3Port int
+}
+
 type Server struct {
-	routes *routing.Cache
+	routes       *routing.Cache
+	certificates *certs.Store
+	acme         *acme.Manager
+	metrics      *metrics.Metrics
+	config       Config
+	budget       *retryBudget
+	transports   *transportCache
 }
 
-func NewServer(routes *routing.Cache) Server {
-	return Server{routes: routes}
+// NewServer creates a router server, the ACME manager is optional and nil disables ACME certificates.
+func NewServer(
+	routes *routing.Cache,
+	certificates *certs.Store,
+	manager *acme.Manager,
+	metrics *metrics.Metrics,
+	config Config,
+) Server {
+	return Server{
+		routes:       routes,
+		certificates: certificates,
+		acme:         manager,
+		metrics:      metrics,
+		config:       config,
+		budget:       newRetryBudget(config.RetryBudget, config.RetryBudgetMin),
+		transports:   newTransportCache(routes, certificates),
+	}
 }
 
 func (s Server) ListenAndServe(ctx context.Context, port int) {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.applyRoute)
+	server := s.newHTTPServer(port)
 
-	server := http.Server{ //nolint:exhaustivestruct
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+	if s.acme != nil {
+		// HTTP-01 challenges are only sent over plain HTTP.
+		server.Handler = s.acme.HTTPHandler(server.Handler)
 	}
 
+	// HTTP/2 is negotiated over TLS, plain connections need h2c for clients like gRPC ones.
+	server.Handler = h2c.NewHandler(server.Handler, &http2.Server{}) //nolint:exhaustivestruct
+
+	newConnTracker(s.metrics).track(server)
+
 	if err := server.ListenAndServe(); err != nil {
 		log.Printf("router server stopped: %v", err)
 
@@ -42,45 +99,206 @@ func (s Server) ListenAndServe(ctx context.Context, port int) {
 	}
 }
 
+// ListenAndServeTLS terminates TLS on the port using certificates from the store picked by SNI.
+// Certificates are looked up on every handshake, so uploaded and deleted certificates apply without a restart.
+// Hosts of routes requesting ACME certificates without an uploaded certificate get one from the ACME manager.
+func (s Server) ListenAndServeTLS(ctx context.Context, port int) {
+	server := s.newHTTPServer(port)
+	server.TLSConfig = &tls.Config{ //nolint:exhaustivestruct
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.getCertificate,
+	}
+
+	if s.acme != nil {
+		server.TLSConfig.NextProtos = []string{"h2", "http/1.1", acmeclient.ALPNProto}
+	}
+
+	newConnTracker(s.metrics).track(server)
+
+	go func() {
+		// Certificates are provided by the store instead of files.
+		if err := server.ListenAndServeTLS("", ""); err != nil {
+			log.Printf("router tls server stopped: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	if err := server.Close(); err != nil {
+		log.Printf("error closing router tls server: %v", err)
+	}
+}
+
+// ListenAndServeHTTP3 serves HTTP/3 over QUIC on the UDP port with the same routes and certificates
+// as ListenAndServeTLS. Clients discover it through Alt-Svc headers of responses over TLS, see Config.HTTP3Port.
+func (s Server) ListenAndServeHTTP3(ctx context.Context, port int) {
+	server := &http3.Server{ //nolint:exhaustivestruct
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: s.newHTTPServer(port).Handler,
+		// Certificates of TLS-ALPN-01 challenges are only requested over TCP.
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{ //nolint:exhaustivestruct
+			MinVersion:     tls.VersionTLS13,
+			GetCertificate: s.getCertificate,
+		}),
+		IdleTimeout: s.config.IdleTimeout,
+		ConnContext: s.trackQUIC,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			log.Printf("router http3 server stopped: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	if err := server.Close(); err != nil {
+		log.Printf("error closing router http3 server: %v", err)
+	}
+}
+
+// getCertificate prefers uploaded certificates, so they can replace ACME certificates at any time.
+func (s Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.acme != nil && acme.IsChallenge(hello) {
+		return s.acme.GetCertificate(hello)
+	}
+
+	cert, err := s.certificates.GetCertificate(hello)
+	if err != nil && s.acme != nil && s.acme.Allowed(hello.ServerName) {
+		return s.acme.GetCertificate(hello)
+	}
+
+	return cert, err
+}
+
+func (s Server) newHTTPServer(port int) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.applyRoute)
+
+	return &http.Server{ //nolint:exhaustivestruct
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		ReadTimeout:       s.config.ReadTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+	}
+}
+
 func (s Server) applyRoute(rw http.ResponseWriter, r *http.Request) {
 	schema := "http"
 	if r.TLS != nil {
 		schema = "https"
 	}
 
-	origins, err := getAddressAliases(fmt.Sprintf("%s://%s", schema, r.RemoteAddr))
+	if misdirected(r) {
+		log.Printf("host %q requested by %q doesn't match server name %q", r.Host, r.RemoteAddr, r.TLS.ServerName)
+		http.Error(rw, "", http.StatusMisdirectedRequest)
+
+		return
+	}
+
+	match, ok, err := s.findRoute(r, schema)
 	if err != nil {
-		log.Printf("error parsing remote address: %v", err)
+		log.Printf("error finding route: %v", err)
 		http.Error(rw, "", http.StatusInternalServerError)
 
 		return
 	}
 
-	for _, origin := range origins {
-		info, ok := s.routes.Get(origin)
-		if !ok {
-			continue
-		}
+	if !ok {
+		log.Printf("no route configured for host %q requested by %q", r.Host, r.RemoteAddr)
+		rw.WriteHeader(http.StatusBadGateway)
+
+		return
+	}
 
-		otherURL := fmt.Sprintf("%s://%s%s", schema, info.To, r.URL.Path)
+	info := match.Route
 
-		switch info.Type {
-		case models.RouteTypeRedirect:
-			http.Redirect(rw, r, otherURL, http.StatusTemporaryRedirect)
-		case models.RouteTypeProxy:
-			proxyRequest(rw, r, otherURL)
-		default:
-			log.Printf("unknown route type %q", info.Type)
+	// Certificate authorities verify HTTP-01 challenges over plain HTTP only.
+	if r.TLS == nil && info.HTTPS.Redirect && !acme.IsChallengePath(r.URL.Path) {
+		http.Redirect(rw, r, httpsURL(r, s.config.HTTPSPort).String(), http.StatusPermanentRedirect)
+
+		return
+	}
+
+	if r.TLS != nil && info.HTTPS.HSTSMaxAge != 0 {
+		rw.Header().Set(hstsHeader, hstsValue(info.HTTPS))
+	}
+
+	if r.TLS != nil && s.config.HTTP3Port != 0 {
+		rw.Header().Set(altSvcHeader, altSvcValue(s.config.HTTP3Port))
+	}
+
+	switch info.Type {
+	case models.RouteTypeRedirect:
+		target, err := redirectURL(schema, match, r)
+		if err != nil {
+			log.Printf("error building redirect url: %v", err)
 			http.Error(rw, "", http.StatusInternalServerError)
 
 			return
 		}
 
+		http.Redirect(rw, r, target.String(), info.RedirectCode)
+	case models.RouteTypeProxy:
+		s.proxyRequest(rw, r, schema, match)
+	default:
+		log.Printf("unknown route type %q", info.Type)
+		http.Error(rw, "", http.StatusInternalServerError)
+
 		return
 	}
+}
 
-	log.Printf("no route configured for host %q", r.RemoteAddr)
-	rw.WriteHeader(http.StatusBadGateway)
+// findRoute looks up a route by the client address and by the requested host,
+// routes matching the client address are preferred if priorities are equal.
+func (s Server) findRoute(r *http.Request, schema string) (routing.Match, bool, error) {
+	sources, err := getAddressAliases(fmt.Sprintf("%s://%s", schema, r.RemoteAddr))
+	if err != nil {
+		return routing.Match{}, false, fmt.Errorf("error parsing remote address: %w", err)
+	}
+
+	hosts, err := getHostAliases(r, schema)
+	if err != nil {
+		return routing.Match{}, false, fmt.Errorf("error parsing requested host: %w", err)
+	}
+
+	match, ok := s.routes.Match(r,
+		routing.Origin{Mode: models.RouteModeSource, Hosts: sources},
+		routing.Origin{Mode: models.RouteModeHost, Hosts: hosts})
+
+	return match, ok, nil
+}
+
+// misdirected reports whether the Host header and SNI of a request over TLS name different hosts,
+// so a certificate of one route can't be used to reach another one.
+func misdirected(r *http.Request) bool {
+	if r.TLS == nil || r.TLS.ServerName == "" || r.Host == "" {
+		return false
+	}
+
+	host := (&url.URL{Host: r.Host}).Hostname() //nolint:exhaustivestruct
+
+	return !strings.EqualFold(strings.TrimSuffix(host, "."), strings.TrimSuffix(r.TLS.ServerName, "."))
+}
+
+// getHostAliases returns aliases of the Host header, SNI is only used without it.
+// Requests with a different Host header and SNI are rejected before, see misdirected.
+// Hosts are normalized the same way as sources of host routes, see routing.NormalizeHost.
+func getHostAliases(r *http.Request, schema string) ([]string, error) {
+	host := r.Host
+	if host == "" && r.TLS != nil {
+		host = r.TLS.ServerName
+	}
+
+	if host == "" {
+		return nil, nil
+	}
+
+	host = routing.NormalizeHost(host)
+
+	return getAddressAliases(fmt.Sprintf("%s://%s", schema, host))
 }
 
 func getAddressAliases(address string) ([]string, error) {
@@ -112,40 +330,3 @@ func getAddressAliases(address string) ([]string, error) {
 
 	return results, nil
 }
-
-func proxyRequest(rw http.ResponseWriter, r *http.Request, otherURL string) {
-	req, err := http.NewRequestWithContext(context.Background(), r.Method, otherURL, r.Body)
-	if err != nil {
-		log.Printf("error creating request: %v", err)
-		http.Error(rw, "", http.StatusBadRequest)
-
-		return
-	}
-
-	req.Header = r.Header
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("error getting content at %q: %v", otherURL, err)
-		http.Error(rw, "", http.StatusBadRequest)
-
-		return
-	}
-
-	defer resp.Body.Close()
-
-	for name, values := range resp.Header {
-		for _, v := range values {
-			rw.Header().Add(name, v)
-		}
-	}
-
-	rw.WriteHeader(resp.StatusCode)
-
-	if _, err := io.Copy(rw, resp.Body); err != nil {
-		log.Printf("error copying request body: %v", err)
-		http.Error(rw, "", http.StatusInternalServerError)
-
-		return
-	}
-}
@@ -1,6 +1,9 @@
 package router
 
 import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -75,3 +78,133 @@ func Test_getAddressAliases(t *testing.T) {
 		})
 	}
 }
+
+func Test_getHostAliases(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		host        string
+		serverName  string
+		parsedHosts []string
+	}{
+		{
+			name:        "host",
+			host:        "example.com",
+			serverName:  "",
+			parsedHosts: []string{"example.com"},
+		},
+		{
+			name:        "host with port",
+			host:        "example.com:8080",
+			serverName:  "",
+			parsedHosts: []string{"example.com:8080", "example.com"},
+		},
+		{
+			name:        "host with sni",
+			host:        "example.com:8443",
+			serverName:  "example.com",
+			parsedHosts: []string{"example.com:8443", "example.com"},
+		},
+		{
+			name:        "sni without host",
+			host:        "",
+			serverName:  "example.com",
+			parsedHosts: []string{"example.com"},
+		},
+		{
+			name:        "mixed case host with trailing dot",
+			host:        "Example.COM.:8080",
+			serverName:  "",
+			parsedHosts: []string{"example.com:8080", "example.com"},
+		},
+		{
+			name:        "localhost",
+			host:        "localhost:8080",
+			serverName:  "",
+			parsedHosts: []string{"localhost:8080", "[::1]:8080", "127.0.0.1:8080", "localhost", "[::1]", "127.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+
+			if tt.serverName != "" {
+				r.TLS = &tls.ConnectionState{ServerName: tt.serverName} //nolint:exhaustivestruct
+			}
+
+			got, err := getHostAliases(r, "http")
+
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.parsedHosts, got)
+		})
+	}
+}
+
+func Test_misdirected(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		host       string
+		serverName string
+		tls        bool
+		expected   bool
+	}{
+		{
+			name:     "plain http",
+			host:     "example.com",
+			expected: false,
+		},
+		{
+			name:       "same host",
+			host:       "example.com:8443",
+			serverName: "example.com",
+			tls:        true,
+			expected:   false,
+		},
+		{
+			name:       "same host in other case",
+			host:       "Example.com",
+			serverName: "example.com",
+			tls:        true,
+			expected:   false,
+		},
+		{
+			name:     "tls without sni",
+			host:     "127.0.0.1:8443",
+			tls:      true,
+			expected: false,
+		},
+		{
+			name:       "other host",
+			host:       "internal.example.com",
+			serverName: "example.com",
+			tls:        true,
+			expected:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{ServerName: tt.serverName} //nolint:exhaustivestruct
+			}
+
+			assert.Equal(t, tt.expected, misdirected(r))
+		})
+	}
+}
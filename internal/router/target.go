@@ -0,0 +1,97 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+// targetURL builds the URL of the target "to" of the matched route for the request.
+// The forwarded path is appended to the path of the target keeping its escaping,
+// and the query is combined according to the query mode of the route.
+// Targets with a scheme ("https://example.com") keep it, others use the scheme of the request.
+func targetURL(schema string, match routing.Match, to string, incoming *url.URL) (*url.URL, error) {
+	target, err := parseTarget(schema, match.Expand(to))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing target of route %d: %w", match.Route.ID, err)
+	}
+
+	escapedPath := match.RawPath
+	if escapedPath == "" {
+		escapedPath = (&url.URL{Path: match.Path}).EscapedPath() //nolint:exhaustivestruct
+	}
+
+	rawPath := joinPaths(target.EscapedPath(), escapedPath)
+
+	target.Path = joinPaths(target.Path, match.Path)
+	if unescaped, err := url.PathUnescape(rawPath); err == nil && unescaped == target.Path {
+		target.RawPath = rawPath
+	}
+
+	target.RawQuery = joinQueries(match.Route.QueryMode, target.RawQuery, incoming.RawQuery)
+	target.ForceQuery = false
+
+	return target, nil
+}
+
+// redirectURL builds the URL of the redirect target filling request placeholders.
+// Full templates are used as is, other targets get the path and the query appended as in targetURL.
+func redirectURL(schema string, match routing.Match, r *http.Request) (*url.URL, error) {
+	match.Captures = routing.RequestCaptures(schema, match, r)
+
+	if !routing.IsFullTemplate(match.Route.To) {
+		return targetURL(schema, match, match.Route.To, r.URL)
+	}
+
+	target, err := parseTarget(schema, match.Target())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing redirect template of route %d: %w", match.Route.ID, err)
+	}
+
+	// Templates like "{path}?{query}" leave a dangling "?" for requests without a query.
+	target.ForceQuery = false
+
+	return target, nil
+}
+
+func parseTarget(schema, target string) (*url.URL, error) {
+	if !strings.Contains(target, "://") {
+		target = fmt.Sprintf("%s://%s", schema, target)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing url %q: %w", target, err)
+	}
+
+	return u, nil
+}
+
+func joinPaths(base, path string) string {
+	if base == "" || base == "/" {
+		return path
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+func joinQueries(mode models.QueryMode, target, incoming string) string {
+	switch mode {
+	case models.QueryModeDrop:
+		return ""
+	case models.QueryModeReplace:
+		return target
+	case models.QueryModeAppend:
+		fallthrough
+	default:
+		if target == "" || incoming == "" {
+			return incoming + target
+		}
+
+		return incoming + "&" + target
+	}
+}
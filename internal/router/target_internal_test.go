@@ -0,0 +1,189 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iskorotkov/router/internal/metrics"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:funlen
+func TestServer_applyRouteRedirectTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		route    models.Route
+		request  string
+		location string
+	}{
+		{
+			name:     "query",
+			route:    models.Route{To: "backend:8080"}, //nolint:exhaustivestruct
+			request:  "/oauth/callback?code=a%2Bb&state=xyz",
+			location: "http://backend:8080/oauth/callback?code=a%2Bb&state=xyz",
+		},
+		{
+			name:     "escaped path",
+			route:    models.Route{To: "backend"}, //nolint:exhaustivestruct
+			request:  "/files/a%2Fb/c%20d",
+			location: "http://backend/files/a%2Fb/c%20d",
+		},
+		{
+			name:     "strip prefix keeps escaping",
+			route:    models.Route{To: "backend", Path: "/files", StripPrefix: true}, //nolint:exhaustivestruct
+			request:  "/files/a%2Fb?x=1",
+			location: "http://backend/a%2Fb?x=1",
+		},
+		{
+			name:     "target path",
+			route:    models.Route{To: "backend/base/"}, //nolint:exhaustivestruct
+			request:  "/a%2Fb",
+			location: "http://backend/base/a%2Fb",
+		},
+		{
+			name:     "append query",
+			route:    models.Route{To: "backend/?source=router"}, //nolint:exhaustivestruct
+			request:  "/?x=1",
+			location: "http://backend/?x=1&source=router",
+		},
+		{
+			name:     "append without incoming query",
+			route:    models.Route{To: "backend?source=router"}, //nolint:exhaustivestruct
+			request:  "/a",
+			location: "http://backend/a?source=router",
+		},
+		{
+			name:     "replace query",
+			route:    models.Route{To: "backend?source=router", QueryMode: models.QueryModeReplace}, //nolint:exhaustivestruct
+			request:  "/a?x=1",
+			location: "http://backend/a?source=router",
+		},
+		{
+			name:     "drop query",
+			route:    models.Route{To: "backend?source=router", QueryMode: models.QueryModeDrop}, //nolint:exhaustivestruct
+			request:  "/a?x=1",
+			location: "http://backend/a",
+		},
+		{
+			name:     "target fragment",
+			route:    models.Route{To: "backend/#/app"}, //nolint:exhaustivestruct
+			request:  "/a?x=1",
+			location: "http://backend/a?x=1#/app",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			routes := routing.New()
+
+			tt.route.ID = 1
+			tt.route.From = "example.com"
+			tt.route.Mode = models.RouteModeHost
+			tt.route.Type = models.RouteTypeRedirect
+			routes.Set(routing.NewRouteInfo(tt.route))
+
+			r := httptest.NewRequest(http.MethodGet, "http://example.com"+tt.request, nil)
+			rw := httptest.NewRecorder()
+
+			NewServer(&routes, newCertificates(), nil, metrics.New(), Config{}).applyRoute(rw, r) //nolint:exhaustivestruct
+
+			assert.Equal(t, http.StatusTemporaryRedirect, rw.Code)
+			assert.Equal(t, tt.location, rw.Header().Get("Location"))
+		})
+	}
+}
+
+//nolint:funlen
+func TestServer_applyRouteRedirectTemplate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		route    models.Route
+		request  string
+		code     int
+		location string
+	}{
+		{
+			name:     "permanent",
+			route:    models.Route{To: "https://example.org", RedirectCode: http.StatusMovedPermanently}, //nolint:exhaustivestruct
+			request:  "/a?x=1",
+			code:     http.StatusMovedPermanently,
+			location: "https://example.org/a?x=1",
+		},
+		{
+			name:     "method preserving",
+			route:    models.Route{To: "example.org", RedirectCode: http.StatusPermanentRedirect}, //nolint:exhaustivestruct
+			request:  "/a",
+			code:     http.StatusPermanentRedirect,
+			location: "http://example.org/a",
+		},
+		{
+			name:     "host template",
+			route:    models.Route{To: "https://www.{hostname}:8443", RedirectCode: http.StatusFound}, //nolint:exhaustivestruct
+			request:  "/a?x=1",
+			code:     http.StatusFound,
+			location: "https://www.example.com:8443/a?x=1",
+		},
+		{
+			name:     "full template",
+			route:    models.Route{To: "https://new.example.org/v2{path}?from={host}&{query}"}, //nolint:exhaustivestruct
+			request:  "/a%2Fb?x=1",
+			code:     http.StatusTemporaryRedirect,
+			location: "https://new.example.org/v2/a%2Fb?from=example.com&x=1",
+		},
+		{
+			name:     "full template without query",
+			route:    models.Route{To: "{scheme}://new.example.org{path}?{query}", RedirectCode: http.StatusSeeOther}, //nolint:exhaustivestruct
+			request:  "/a",
+			code:     http.StatusSeeOther,
+			location: "http://new.example.org/a",
+		},
+		{
+			name:     "rest and captures",
+			route:    models.Route{From: `(?P<app>\w+)\.example\.com`, FromMatch: models.FromMatchRegex, To: "{app}.example.org{rest}", Path: "/old", StripPrefix: true}, //nolint:exhaustivestruct,lll
+			request:  "/old/a",
+			code:     http.StatusTemporaryRedirect,
+			location: "http://shop.example.org/a",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			routes := routing.New()
+
+			host := "example.com"
+			if tt.route.From == "" {
+				tt.route.From = host
+			} else {
+				host = "shop.example.com"
+			}
+
+			tt.route.ID = 1
+			tt.route.Mode = models.RouteModeHost
+			tt.route.Type = models.RouteTypeRedirect
+			routes.Set(routing.NewRouteInfo(tt.route))
+
+			r := httptest.NewRequest(http.MethodPost, "http://"+host+tt.request, nil)
+			rw := httptest.NewRecorder()
+
+			NewServer(&routes, newCertificates(), nil, metrics.New(), Config{}).applyRoute(rw, r) //nolint:exhaustivestruct
+
+			assert.Equal(t, tt.code, rw.Code)
+			assert.Equal(t, tt.location, rw.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/iskorotkov/router/internal/metrics"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+// drainLimit is how much of a discarded response is read to reuse its connection.
+const drainLimit = 4 << 10
+
+var (
+	ErrNoTarget      = fmt.Errorf("no available targets")
+	ErrInvalidTarget = fmt.Errorf("invalid target")
+)
+
+// upstreamTransport sends a proxied request to a target of the route picked for every attempt.
+// Failed attempts are retried according to the retry policy of the route while the retry budget allows it.
+// Results of all attempts are reported to the circuit breakers of the targets.
+type upstreamTransport struct {
+	transports *transportCache
+	schema     string
+	match      routing.Match
+	incoming   *url.URL
+	budget     *retryBudget
+	metrics    *metrics.Metrics
+	bufferSize int64
+	// current is the target of the last attempt, it is released by done.
+	current *routing.Target
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	info := t.match.Route
+	// gRPC calls are streams that can't be buffered, and they report failures in trailers anyway.
+	retries := info.Retry.Enabled(req.Method) && !isGRPC(req)
+
+	body, retries, err := bufferBody(req, retries, t.bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if retries {
+		t.budget.request(time.Now())
+	}
+
+	var (
+		resp    *http.Response
+		lastErr error
+	)
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if !t.prepareRetry(req, attempt, resp, lastErr) {
+				return resp, lastErr
+			}
+
+			discard(resp)
+		}
+
+		upstream, ok := info.Pick(req)
+		if !ok {
+			return nil, fmt.Errorf("route %d: %w", info.ID, ErrNoTarget)
+		}
+
+		t.done()
+		t.current = &upstream
+
+		target, err := targetURL(t.schema, t.match, upstream.Address, t.incoming)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrInvalidTarget)
+		}
+
+		out := req.Clone(req.Context())
+		if body != nil {
+			out.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		setTarget(out, target)
+
+		transport, err := t.transports.get(info, upstream)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, lastErr = transport.RoundTrip(out)
+
+		switch {
+		case lastErr != nil && errors.Is(req.Context().Err(), context.Canceled):
+			// The client went away, that says nothing about the target.
+			return resp, lastErr
+		case lastErr != nil:
+			upstream.Report(false)
+		default:
+			upstream.Report(resp.StatusCode < http.StatusInternalServerError)
+		}
+
+		if !retries || attempt >= info.Retry.Attempts || req.Context().Err() != nil ||
+			!retryable(info.Retry, resp, lastErr) {
+			return resp, lastErr
+		}
+	}
+}
+
+// prepareRetry waits before the attempt and reports whether it can be made.
+func (t *upstreamTransport) prepareRetry(req *http.Request, attempt int, resp *http.Response, err error) bool {
+	if !t.budget.withdraw(time.Now()) {
+		t.metrics.RetryDenied()
+		log.Printf("retry budget exhausted, not retrying request to route %d", t.match.Route.ID)
+
+		return false
+	}
+
+	reason := fmt.Sprint(err)
+	if resp != nil {
+		reason = resp.Status
+	}
+
+	log.Printf("retrying request to route %d, attempt %d: %s", t.match.Route.ID, attempt, reason)
+
+	timer := time.NewTimer(t.match.Route.Retry.BackoffFor(attempt - 1))
+	defer timer.Stop()
+
+	select {
+	case <-req.Context().Done():
+		return false
+	case <-timer.C:
+	}
+
+	t.metrics.Retried()
+
+	return true
+}
+
+// done releases the target of the last attempt.
+func (t *upstreamTransport) done() {
+	if t.current != nil {
+		t.current.Done()
+		t.current = nil
+	}
+}
+
+// bufferBody reads the request body so it can be sent again on retries.
+// Bodies larger than the limit are streamed and the request isn't retried.
+func bufferBody(req *http.Request, retries bool, limit int64) ([]byte, bool, error) {
+	if !retries || req.Body == nil || req.Body == http.NoBody {
+		return nil, retries, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading request body: %w", err)
+	}
+
+	if int64(len(body)) > limit {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{
+			Reader: io.MultiReader(bytes.NewReader(body), req.Body),
+			Closer: req.Body,
+		}
+
+		return nil, false, nil
+	}
+
+	_ = req.Body.Close()
+
+	return body, true, nil
+}
+
+func retryable(policy routing.RetryPolicy, resp *http.Response, err error) bool {
+	if err != nil {
+		return policy.RetriesError(errorKind(err))
+	}
+
+	return policy.RetriesStatus(resp.StatusCode)
+}
+
+// errorKind classifies the error of an attempt, failing to connect in time is a connect error.
+func errorKind(err error) models.RetryError {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return models.RetryOnConnect
+	}
+
+	if isTimeout(err) {
+		return models.RetryOnTimeout
+	}
+
+	return models.RetryOnReset
+}
+
+func discard(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, drainLimit))
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,157 @@
+package router
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/iskorotkov/router/internal/certs"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+const expectContinueTimeout = time.Second
+
+// transportCache keeps a transport for every target of proxy routes, so connections to targets are reused
+// between requests and limits of the route apply to each target separately.
+// Transports are rebuilt when settings of the route or certificates change and dropped when the target is removed.
+type transportCache struct {
+	routes       *routing.Cache
+	certificates *certs.Store
+	transports   map[transportKey]upstreamPool
+	m            sync.Mutex
+}
+
+type transportKey struct {
+	route uint
+	// address is the configured address of the target, targets built from captured values share one transport.
+	address string
+}
+
+type upstreamPool struct {
+	timeouts  models.Timeouts
+	pool      models.Pool
+	tls       models.UpstreamTLS
+	revision  uint64
+	transport poolTransport
+}
+
+// poolTransport is either an HTTP/1 transport negotiating HTTP/2 over TLS or an h2c transport.
+type poolTransport interface {
+	http.RoundTripper
+	CloseIdleConnections()
+}
+
+func newTransportCache(routes *routing.Cache, certificates *certs.Store) *transportCache {
+	return &transportCache{
+		routes:       routes,
+		certificates: certificates,
+		transports:   make(map[transportKey]upstreamPool),
+		m:            sync.Mutex{},
+	}
+}
+
+// get returns the transport for requests of the route sent to the target.
+func (c *transportCache) get(info routing.RouteInfo, target routing.Target) (poolTransport, error) {
+	key := transportKey{route: info.ID, address: target.Address}
+	revision := c.certificates.Revision()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	current, ok := c.transports[key]
+	if ok && current.timeouts == info.Timeouts && current.pool == info.Pool &&
+		current.tls == info.UpstreamTLS && current.revision == revision {
+		return current.transport, nil
+	}
+
+	tlsConfig, err := c.certificates.ClientConfig(info.UpstreamTLS)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring tls of route %d: %w", info.ID, err)
+	}
+
+	if ok {
+		current.transport.CloseIdleConnections()
+	} else {
+		// Targets are only added with new routes, so it's a good time to forget removed ones.
+		c.prune()
+	}
+
+	transport := newTransport(info.Timeouts, info.Pool, tlsConfig)
+	c.transports[key] = upstreamPool{
+		timeouts:  info.Timeouts,
+		pool:      info.Pool,
+		tls:       info.UpstreamTLS,
+		revision:  revision,
+		transport: transport,
+	}
+
+	return transport, nil
+}
+
+// prune closes transports of targets that were removed with their routes.
+func (c *transportCache) prune() {
+	for key, pool := range c.transports {
+		if c.hasTarget(key) {
+			continue
+		}
+
+		pool.transport.CloseIdleConnections()
+		delete(c.transports, key)
+	}
+}
+
+func (c *transportCache) hasTarget(key transportKey) bool {
+	info, ok := c.routes.Get(key.route)
+	if !ok {
+		return false
+	}
+
+	for _, target := range info.Targets {
+		if target.Address == key.address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newTransport returns a transport for a single target with timeouts, connection limits and TLS settings of a route.
+func newTransport(timeouts models.Timeouts, pool models.Pool, tlsConfig *tls.Config) poolTransport {
+	dialer := &net.Dialer{ //nolint:exhaustivestruct
+		Timeout:   time.Duration(timeouts.Dial),
+		KeepAlive: time.Duration(pool.KeepAlive),
+	}
+
+	transport := &http.Transport{ //nolint:exhaustivestruct
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !pool.DisableHTTP2,
+		MaxIdleConns:          pool.MaxIdleConns,
+		MaxIdleConnsPerHost:   pool.MaxIdleConns,
+		MaxConnsPerHost:       pool.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(pool.IdleTimeout),
+		TLSHandshakeTimeout:   time.Duration(timeouts.TLSHandshake),
+		ResponseHeaderTimeout: time.Duration(timeouts.ResponseHeader),
+		ExpectContinueTimeout: expectContinueTimeout,
+		TLSClientConfig:       tlsConfig,
+	}
+
+	if pool.DisableHTTP2 {
+		// A non-nil empty map disables the automatic HTTP/2 upgrade of TLS connections.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if pool.H2C {
+		// The transport speaks HTTP/2 to plain targets without negotiation, pool limits and timeouts still apply.
+		// Proxies can't forward h2c, so targets are reached directly.
+		transport.Proxy = nil
+		transport.Protocols = &http.Protocols{}
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	return transport
+}
@@ -0,0 +1,222 @@
+package router
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/metrics"
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTransportCache_get(t *testing.T) {
+	t.Parallel()
+
+	routes := routing.New()
+	cache := newTransportCache(&routes, newCertificates())
+
+	route := models.Route{ //nolint:exhaustivestruct
+		Model: gorm.Model{ID: 1}, //nolint:exhaustivestruct
+		From:  "example.com",
+		To:    "upstream",
+		Type:  models.RouteTypeProxy,
+	}
+
+	routes.Set(routing.NewRouteInfo(route))
+	info, _ := routes.Get(1)
+
+	first, err := cache.get(info, info.Targets[0])
+	assert.NoError(t, err)
+
+	same, err := cache.get(info, info.Targets[0])
+	assert.NoError(t, err)
+	assert.Same(t, first, same)
+
+	route.Pool.MaxConnsPerHost = 10
+	routes.Set(routing.NewRouteInfo(route))
+	info, _ = routes.Get(1)
+
+	second, err := cache.get(info, info.Targets[0])
+	assert.NoError(t, err)
+	assert.NotSame(t, first, second)
+	assert.Equal(t, 10, second.(*http.Transport).MaxConnsPerHost)
+
+	routes.Remove(1)
+	routes.Set(routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+		Model: gorm.Model{ID: 2}, //nolint:exhaustivestruct
+		From:  "example.com",
+		To:    "upstream",
+		Type:  models.RouteTypeProxy,
+	}))
+	info, _ = routes.Get(2)
+
+	_, err = cache.get(info, info.Targets[0])
+	assert.NoError(t, err)
+	assert.Len(t, cache.transports, 1)
+}
+
+func TestServer_applyRouteProxyH2CPool(t *testing.T) {
+	t.Parallel()
+
+	var closed int64
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		_, _ = fmt.Fprint(rw, r.Proto)
+	}))
+	// Unlike the h2c handler, the server reports states of HTTP/2 connections.
+	upstream.Config.Protocols = &http.Protocols{}
+	upstream.Config.Protocols.SetUnencryptedHTTP2(true)
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			atomic.AddInt64(&closed, 1)
+		}
+	}
+
+	upstream.Start()
+	t.Cleanup(upstream.Close)
+
+	s := newRouteServer(t, models.Route{ //nolint:exhaustivestruct
+		To:       upstream.Listener.Addr().String(),
+		Pool:     models.Pool{H2C: true, IdleTimeout: models.Duration(100 * time.Millisecond)}, //nolint:exhaustivestruct,lll
+		Timeouts: models.Timeouts{ResponseHeader: models.Duration(200 * time.Millisecond)},     //nolint:exhaustivestruct
+	}, Config{}) //nolint:exhaustivestruct
+
+	get := func(path string) *httptest.ResponseRecorder {
+		// The scheme of the request doesn't matter for h2c targets.
+		r := httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil)
+		r.TLS = &tls.ConnectionState{ServerName: "example.com"} //nolint:exhaustivestruct
+		rw := httptest.NewRecorder()
+
+		s.applyRoute(rw, r)
+
+		return rw
+	}
+
+	rw := get("/")
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "HTTP/2.0", rw.Body.String())
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&closed) == 1
+	}, 5*time.Second, 10*time.Millisecond, "idle connections must be closed")
+
+	assert.Equal(t, http.StatusGatewayTimeout, get("/slow").Code, "response header timeout must apply")
+}
+
+// BenchmarkServer_applyRouteProxy compares proxying through the shared http.DefaultTransport, as requests were
+// proxied before targets got their own pools, with the default pool of a target under concurrent load.
+// http.DefaultTransport keeps only 2 idle connections per host and closes the rest, so with clients pausing
+// between requests it opens a new connection for most of them. req/s is the throughput and conns/op shows
+// how many connections to the upstream were opened per request.
+//
+//nolint:funlen
+func BenchmarkServer_applyRouteProxy(b *testing.B) {
+	const (
+		parallelism = 16
+		delay       = time.Millisecond
+	)
+
+	var conns int64
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		_, _ = fmt.Fprint(rw, "ok")
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+
+	upstream.Start()
+	defer upstream.Close()
+
+	target, err := url.Parse(upstream.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarks := []struct {
+		name    string
+		handler func() http.Handler
+	}{
+		{
+			name: "default transport",
+			handler: func() http.Handler {
+				http.DefaultTransport.(*http.Transport).CloseIdleConnections() //nolint:forcetypeassert
+
+				return &httputil.ReverseProxy{ //nolint:exhaustivestruct
+					Director: func(req *http.Request) {
+						setForwardedHeaders(req)
+						req.URL.Scheme = target.Scheme
+						req.URL.Host = target.Host
+					},
+					Transport: http.DefaultTransport,
+				}
+			},
+		},
+		{
+			name: "route pool",
+			handler: func() http.Handler {
+				routes := routing.New()
+				routes.Set(routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+					Model: gorm.Model{ID: 1}, //nolint:exhaustivestruct
+					From:  "example.com",
+					Mode:  models.RouteModeHost,
+					To:    target.Host,
+					Type:  models.RouteTypeProxy,
+				}))
+
+				s := NewServer(&routes, newCertificates(), nil, metrics.New(), Config{}) //nolint:exhaustivestruct
+
+				return http.HandlerFunc(s.applyRoute)
+			},
+		},
+	}
+
+	for _, bb := range benchmarks {
+		bb := bb
+
+		b.Run(bb.name, func(b *testing.B) {
+			handler := bb.handler()
+
+			b.SetParallelism(parallelism)
+			b.ResetTimer()
+
+			atomic.StoreInt64(&conns, 0)
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+					rw := httptest.NewRecorder()
+
+					handler.ServeHTTP(rw, r)
+
+					if rw.Code != http.StatusOK {
+						b.Errorf("unexpected status code %d", rw.Code)
+					}
+
+					// Clients pause between requests, so connections stay idle for a while.
+					time.Sleep(delay)
+				}
+			})
+
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+			b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iskorotkov/router/internal/metrics"
+)
+
+var ErrNotReadWriter = fmt.Errorf("upgraded response body is not writable")
+
+// isUpgradeResponse reports whether the upstream switched the connection to another protocol.
+func isUpgradeResponse(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusSwitchingProtocols &&
+		strings.Contains(strings.ToLower(resp.Header.Get("Connection")), "upgrade")
+}
+
+// trackUpgrade wraps the upgraded upstream connection so that it is counted in metrics
+// and closed after being idle in both directions for the timeout.
+func trackUpgrade(resp *http.Response, m *metrics.Metrics, idleTimeout time.Duration) error {
+	body, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return ErrNotReadWriter
+	}
+
+	conn := &upgradedConn{
+		ReadWriteCloser: body,
+		metrics:         m,
+		idle:            nil,
+		timeout:         idleTimeout,
+		once:            sync.Once{},
+	}
+
+	if idleTimeout > 0 {
+		conn.idle = time.AfterFunc(idleTimeout, func() {
+			log.Printf("closing upgraded connection to %q after %v of inactivity", resp.Request.URL, idleTimeout)
+
+			_ = conn.Close()
+		})
+	}
+
+	m.UpgradeOpened()
+
+	resp.Body = conn
+
+	return nil
+}
+
+// upgradedConn is an upstream connection after a protocol switch.
+// Data sent by the client is written to it, and data sent by the upstream is read from it,
+// so every Read and Write postpones the idle timeout.
+type upgradedConn struct {
+	io.ReadWriteCloser
+	metrics *metrics.Metrics
+	idle    *time.Timer
+	timeout time.Duration
+	once    sync.Once
+}
+
+func (c *upgradedConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.touch()
+
+	return n, err //nolint:wrapcheck
+}
+
+func (c *upgradedConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.touch()
+
+	return n, err //nolint:wrapcheck
+}
+
+func (c *upgradedConn) Close() error {
+	c.once.Do(func() {
+		if c.idle != nil {
+			c.idle.Stop()
+		}
+
+		c.metrics.UpgradeClosed()
+	})
+
+	return c.ReadWriteCloser.Close() //nolint:wrapcheck
+}
+
+func (c *upgradedConn) touch() {
+	if c.idle != nil {
+		c.idle.Reset(c.timeout)
+	}
+}
@@ -0,0 +1,117 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// newEchoUpgradeServer returns an upstream that switches to an echo protocol.
+func newEchoUpgradeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			rw.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		conn, buf, err := rw.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+
+			return
+		}
+		defer conn.Close()
+
+		_, _ = fmt.Fprint(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_, _ = io.Copy(conn, buf)
+	}))
+}
+
+// dialUpgrade opens a connection to the router and switches it to the echo protocol.
+func dialUpgrade(t *testing.T, router *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", router.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	return conn, reader
+}
+
+func TestServer_applyRouteUpgrade(t *testing.T) {
+	t.Parallel()
+
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	s := newRouteServer(t, models.Route{To: upstreamAddress(t, upstream)}, Config{UpgradeIdleTimeout: time.Minute}) //nolint:exhaustivestruct,lll
+
+	router := httptest.NewServer(http.HandlerFunc(s.applyRoute))
+	defer router.Close()
+
+	conn, reader := dialUpgrade(t, router)
+
+	for _, message := range []string{"ping\n", "pong\n"} {
+		_, _ = fmt.Fprint(conn, message)
+
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, message, line)
+	}
+
+	assert.EqualValues(t, 1, s.metrics.Snapshot().UpgradedConnectionsOpen)
+
+	_ = conn.Close()
+
+	assert.Eventually(t, func() bool {
+		return s.metrics.Snapshot().UpgradedConnectionsOpen == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, s.metrics.Snapshot().UpgradedConnectionsTotal)
+}
+
+func TestServer_applyRouteUpgradeIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+
+	s := newRouteServer(t, models.Route{To: upstreamAddress(t, upstream)}, Config{UpgradeIdleTimeout: 50 * time.Millisecond}) //nolint:exhaustivestruct,lll
+
+	router := httptest.NewServer(http.HandlerFunc(s.applyRoute))
+	defer router.Close()
+
+	conn, reader := dialUpgrade(t, router)
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	_, err := reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+
+	assert.Eventually(t, func() bool {
+		return s.metrics.Snapshot().UpgradedConnectionsOpen == 0
+	}, time.Second, 10*time.Millisecond)
+}
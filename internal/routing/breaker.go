@@ -0,0 +1,210 @@
+package routing
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+const (
+	defaultEjection    = models.Duration(30 * time.Second)
+	defaultMaxEjection = models.Duration(5 * time.Minute)
+)
+
+const (
+	// CircuitClosed targets receive requests.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen targets are ejected until the ejection ends.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen targets receive a single trial request that decides whether they are closed or open again.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type CircuitState string
+
+// Circuit describes the circuit breaker of a target.
+type Circuit struct {
+	State CircuitState
+	// Failures is the number of failed requests in a row.
+	Failures int
+	// Ejections is the number of ejections in a row without a successful trial request.
+	Ejections int
+	// Until is the end of the current ejection.
+	Until time.Time
+	// Changed is the time of the last change of the state.
+	Changed time.Time
+}
+
+// breaker holds the circuit of a target shared by all requests.
+type breaker struct {
+	circuit Circuit
+	// trial is the id of the trial request in progress, zero if there is none.
+	trial uint64
+	// trials is the id of the last trial request.
+	trials uint64
+	m      sync.Mutex
+}
+
+func newBreaker() *breaker {
+	return &breaker{
+		circuit: Circuit{
+			State:     CircuitClosed,
+			Failures:  0,
+			Ejections: 0,
+			Until:     time.Time{},
+			Changed:   time.Time{},
+		},
+		trial:  0,
+		trials: 0,
+		m:      sync.Mutex{},
+	}
+}
+
+// circuitBreakerDefaults fills zero settings of the enabled circuit breaker.
+func circuitBreakerDefaults(config models.CircuitBreaker) models.CircuitBreaker {
+	if config.Ejection == 0 {
+		config.Ejection = defaultEjection
+	}
+
+	if config.MaxEjection == 0 {
+		config.MaxEjection = defaultMaxEjection
+	}
+
+	return config
+}
+
+func (b *breaker) snapshot() Circuit {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.circuit
+}
+
+// available reports whether the target can receive a request now.
+func (b *breaker) available(now time.Time) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	switch b.circuit.State {
+	case CircuitOpen:
+		return !now.Before(b.circuit.Until)
+	case CircuitHalfOpen:
+		return b.trial == 0
+	case CircuitClosed:
+		fallthrough
+	default:
+		return true
+	}
+}
+
+// acquire reserves the target for the request picked for it. It returns the id of the trial request
+// if the request is one, zero otherwise, and false if the target can't receive the request:
+// it's still ejected or another request picked it for the trial first.
+func (b *breaker) acquire(t Target, now time.Time) (uint64, bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.circuit.State == CircuitOpen && !now.Before(b.circuit.Until) {
+		b.change(t, CircuitHalfOpen, now)
+	}
+
+	switch b.circuit.State {
+	case CircuitOpen:
+		return 0, false
+	case CircuitHalfOpen:
+		if b.trial != 0 {
+			return 0, false
+		}
+
+		b.trials++
+		b.trial = b.trials
+
+		return b.trial, true
+	case CircuitClosed:
+		fallthrough
+	default:
+		return 0, true
+	}
+}
+
+// report records the result of a request sent to the target.
+func (b *breaker) report(t Target, success bool, now time.Time) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	switch b.circuit.State {
+	case CircuitClosed:
+		if success {
+			b.circuit.Failures = 0
+
+			return
+		}
+
+		b.circuit.Failures++
+
+		if b.circuit.Failures >= t.circuitBreaker.Failures {
+			b.eject(t, now)
+		}
+	case CircuitHalfOpen:
+		// Only the trial request decides the state, others were sent before the target was ejected.
+		if t.trial == 0 || t.trial != b.trial {
+			return
+		}
+
+		b.trial = 0
+
+		if success {
+			b.circuit.Failures = 0
+			b.circuit.Ejections = 0
+			b.circuit.Until = time.Time{}
+			b.change(t, CircuitClosed, now)
+
+			return
+		}
+
+		b.circuit.Failures++
+		b.eject(t, now)
+	case CircuitOpen:
+	}
+}
+
+// release gives up the trial request of the target if it didn't report a result,
+// for example because the client went away.
+func (b *breaker) release(t Target) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if t.trial != 0 && t.trial == b.trial {
+		b.trial = 0
+	}
+}
+
+// eject opens the circuit, every ejection in a row is twice as long as the previous one.
+func (b *breaker) eject(t Target, now time.Time) {
+	maxEjection := time.Duration(t.circuitBreaker.MaxEjection)
+
+	ejection := time.Duration(t.circuitBreaker.Ejection)
+	for i := 0; i < b.circuit.Ejections && ejection < maxEjection; i++ {
+		ejection *= 2
+	}
+
+	if ejection > maxEjection {
+		ejection = maxEjection
+	}
+
+	b.circuit.Ejections++
+	b.circuit.Until = now.Add(ejection)
+	b.change(t, CircuitOpen, now)
+
+	log.Printf("target %q of route %d is ejected for %v after %d failures in a row",
+		t.Address, t.route, ejection, b.circuit.Failures)
+}
+
+func (b *breaker) change(t Target, state CircuitState, now time.Time) {
+	log.Printf("circuit of target %q of route %d changed from %s to %s", t.Address, t.route, b.circuit.State, state)
+
+	b.circuit.State = state
+	b.circuit.Changed = now
+}
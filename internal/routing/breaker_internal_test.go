@@ -0,0 +1,168 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newBreakerRoute(ejection time.Duration, addresses ...string) RouteInfo {
+	route := models.Route{ //nolint:exhaustivestruct
+		Model: gorm.Model{ID: 1}, //nolint:exhaustivestruct
+		From:  "host",
+		Type:  models.RouteTypeProxy,
+		CircuitBreaker: models.CircuitBreaker{
+			Failures:    2,
+			Ejection:    models.Duration(ejection),
+			MaxEjection: models.Duration(3 * ejection),
+		},
+	}
+
+	for i, address := range addresses {
+		route.Targets = append(route.Targets, models.Target{ //nolint:exhaustivestruct
+			Model:   gorm.Model{ID: uint(i + 1)}, //nolint:exhaustivestruct
+			Address: address,
+			Weight:  1,
+		})
+	}
+
+	cache := New()
+	cache.Set(NewRouteInfo(route))
+
+	info, _ := cache.Get(1)
+
+	return info
+}
+
+func pickAndReport(t *testing.T, info RouteInfo, success bool) string {
+	t.Helper()
+
+	target, ok := info.Pick(httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ok {
+		t.Fatal("no target picked")
+	}
+
+	target.Report(success)
+	target.Done()
+
+	return target.Address
+}
+
+func TestRouteInfo_PickCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	info := newBreakerRoute(time.Hour, "a", "b")
+
+	assert.Equal(t, "a", pickAndReport(t, info, false))
+	assert.Equal(t, "b", pickAndReport(t, info, true))
+	assert.Equal(t, CircuitClosed, info.Targets[0].Circuit().State)
+
+	assert.Equal(t, "a", pickAndReport(t, info, false))
+	assert.Equal(t, CircuitOpen, info.Targets[0].Circuit().State)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b", pickAndReport(t, info, true))
+	}
+}
+
+//nolint:funlen
+func TestRouteInfo_PickCircuitBreakerTrial(t *testing.T) {
+	t.Parallel()
+
+	const ejection = 50 * time.Millisecond
+
+	info := newBreakerRoute(ejection, "a")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	pickAndReport(t, info, false)
+	pickAndReport(t, info, false)
+
+	circuit := info.Targets[0].Circuit()
+	assert.Equal(t, CircuitOpen, circuit.State)
+	assert.Equal(t, ejection, circuit.Until.Sub(circuit.Changed))
+
+	_, ok := info.Pick(r)
+	assert.False(t, ok, "ejected target must not be picked")
+
+	time.Sleep(ejection)
+
+	trial, ok := info.Pick(r)
+	assert.True(t, ok)
+	assert.Equal(t, CircuitHalfOpen, info.Targets[0].Circuit().State)
+
+	_, ok = info.Pick(r)
+	assert.False(t, ok, "only a single trial request is allowed")
+
+	trial.Report(false)
+	trial.Done()
+
+	circuit = info.Targets[0].Circuit()
+	assert.Equal(t, CircuitOpen, circuit.State)
+	assert.Equal(t, 2*ejection, circuit.Until.Sub(circuit.Changed), "ejection must grow exponentially")
+
+	time.Sleep(2 * ejection)
+
+	// A trial without a result doesn't change the state but lets another trial happen.
+	trial, ok = info.Pick(r)
+	assert.True(t, ok)
+	trial.Done()
+
+	pickAndReport(t, info, true)
+
+	circuit = info.Targets[0].Circuit()
+	assert.Equal(t, CircuitClosed, circuit.State)
+	assert.Zero(t, circuit.Ejections)
+}
+
+func TestRouteInfo_PickCircuitBreakerConcurrentTrial(t *testing.T) {
+	t.Parallel()
+
+	const ejection = 10 * time.Millisecond
+
+	info := newBreakerRoute(ejection, "a", "b")
+
+	// Fail "a" twice in a row, "b" is picked in between by the round-robin.
+	pickAndReport(t, info, false)
+	pickAndReport(t, info, true)
+	pickAndReport(t, info, false)
+	assert.Equal(t, CircuitOpen, info.Targets[0].Circuit().State)
+
+	time.Sleep(ejection)
+
+	var (
+		wg     sync.WaitGroup
+		m      sync.Mutex
+		trials int
+	)
+
+	start := make(chan struct{})
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			// Targets aren't released, so the trial stays in progress.
+			target, ok := info.Pick(httptest.NewRequest(http.MethodGet, "/", nil))
+			if ok && target.Address == "a" {
+				m.Lock()
+				trials++
+				m.Unlock()
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, 1, trials, "only a single trial request is allowed")
+}
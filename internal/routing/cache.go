@@ -1,69 +1,541 @@
 package routing
 
 import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/iskorotkov/router/internal/models"
 )
 
 type RouteInfo struct {
-	To   string
-	Type models.RouteType
+	ID             uint
+	From           string
+	FromMatch      models.FromMatch
+	To             string
+	Type           models.RouteType
+	Mode           models.RouteMode
+	Path           string
+	PathMatch      models.PathMatch
+	StripPrefix    bool
+	Predicates     []Predicate
+	Priority       int
+	QueryMode      models.QueryMode
+	RedirectCode   int
+	FlushInterval  models.Duration
+	Targets        []Target
+	Balance        models.Balance
+	BalanceHeader  string
+	HealthCheck    models.HealthCheck
+	CircuitBreaker models.CircuitBreaker
+	Retry          RetryPolicy
+	Timeouts       models.Timeouts
+	Pool           models.Pool
+	UpstreamTLS    models.UpstreamTLS
+	HTTPS          models.HTTPS
+	ACME           bool
+	ListenPort     int
+	balancer       *balancer
 }
 
+// NewRouteInfo converts a stored route to its in-memory representation filling in default values.
+func NewRouteInfo(route models.Route) RouteInfo {
+	info := RouteInfo{
+		ID:             route.ID,
+		From:           route.From,
+		FromMatch:      route.FromMatch,
+		To:             route.To,
+		Type:           route.Type,
+		Mode:           route.Mode,
+		Path:           route.Path,
+		PathMatch:      route.PathMatch,
+		StripPrefix:    route.StripPrefix,
+		Predicates:     nil,
+		Priority:       route.Priority,
+		QueryMode:      route.QueryMode,
+		RedirectCode:   route.RedirectCode,
+		FlushInterval:  route.FlushInterval,
+		Targets:        nil,
+		Balance:        route.Balance,
+		BalanceHeader:  route.BalanceHeader,
+		HealthCheck:    route.HealthCheck,
+		CircuitBreaker: route.CircuitBreaker,
+		Retry:          RetryPolicy{}, //nolint:exhaustivestruct
+		Timeouts:       route.Timeouts,
+		Pool:           route.Pool,
+		UpstreamTLS:    route.UpstreamTLS,
+		HTTPS:          route.HTTPS,
+		ACME:           route.ACME,
+		ListenPort:     route.ListenPort,
+		balancer:       nil,
+	}
+
+	for _, predicate := range route.Predicates {
+		info.Predicates = append(info.Predicates, NewPredicate(predicate))
+	}
+
+	for _, target := range route.Targets {
+		info.Targets = append(info.Targets, NewTarget(target))
+	}
+
+	if len(info.Targets) == 0 && (info.Type == models.RouteTypeProxy || info.Type == models.RouteTypeTCP) {
+		info.Targets = []Target{NewTarget(models.Target{Address: info.To, Weight: 1})} //nolint:exhaustivestruct
+	}
+
+	if info.Balance == "" {
+		info.Balance = models.BalanceRoundRobin
+	}
+
+	if info.Mode == "" {
+		info.Mode = models.RouteModeSource
+	}
+
+	if info.FromMatch == "" {
+		info.FromMatch = models.FromMatchExact
+	}
+
+	if info.Path == "" {
+		info.Path = "/"
+	}
+
+	if info.PathMatch == "" {
+		info.PathMatch = models.PathMatchPrefix
+	}
+
+	if info.QueryMode == "" {
+		info.QueryMode = models.QueryModeAppend
+	}
+
+	if info.RedirectCode == 0 {
+		info.RedirectCode = http.StatusTemporaryRedirect
+	}
+
+	if info.HealthCheck.Type != "" {
+		info.HealthCheck = healthCheckDefaults(info.HealthCheck)
+	}
+
+	if info.CircuitBreaker.Failures != 0 {
+		info.CircuitBreaker = circuitBreakerDefaults(info.CircuitBreaker)
+	}
+
+	if info.Type == models.RouteTypeProxy {
+		info.Timeouts = timeoutsDefaults(info.Timeouts)
+		info.Pool = poolDefaults(info.Pool)
+	}
+
+	if info.Type == models.RouteTypeTCP {
+		info.Timeouts = models.Timeouts{Dial: timeoutsDefaults(info.Timeouts).Dial} //nolint:exhaustivestruct
+	}
+
+	retry, err := ParseRetry(route.Retry)
+	if err != nil {
+		log.Printf("retries of route %d are disabled: %v", route.ID, err)
+	}
+
+	info.Retry = retry
+
+	return info
+}
+
+// Match is a route selected for a request.
+type Match struct {
+	Route RouteInfo
+	// Path is the request path that should be sent to the target.
+	Path string
+	// RawPath is the escaped form of Path if it differs from the default encoding.
+	RawPath string
+	// Captures holds values captured by wildcard and regex sources.
+	Captures map[string]string
+}
+
+// Target returns the route target with captured values substituted.
+func (m Match) Target() string {
+	return m.Expand(m.Route.To)
+}
+
+// Expand substitutes captured values in the template.
+func (m Match) Expand(template string) string {
+	return Expand(template, m.Captures)
+}
+
+type hostKey struct {
+	mode models.RouteMode
+	host string
+}
+
+// Cache keeps routes indexed by their sources.
+// Exact sources are stored in hosts, networks of source routes in a prefix tree,
+// wildcards in wildcards by their suffix (".example.com"), and regex sources in patterns in the order they were added.
 type Cache struct {
-	routes map[string]RouteInfo
-	m      sync.RWMutex
+	routes    map[uint]RouteInfo
+	hosts     map[hostKey]*pathTable
+	networks  *prefixTree
+	wildcards map[hostKey]*pathTable
+	patterns  []*hostPattern
+	m         sync.RWMutex
 }
 
 func New() Cache {
 	return Cache{
-		routes: make(map[string]RouteInfo),
-		m:      sync.RWMutex{},
+		routes:    make(map[uint]RouteInfo),
+		hosts:     make(map[hostKey]*pathTable),
+		networks:  newPrefixTree(),
+		wildcards: make(map[hostKey]*pathTable),
+		patterns:  nil,
+		m:         sync.RWMutex{},
 	}
 }
 
-func (c *Cache) Get(key string) (RouteInfo, bool) {
+func (c *Cache) Get(id uint) (RouteInfo, bool) {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
-	value, ok := c.routes[key]
+	value, ok := c.routes[id]
 
 	return value, ok
 }
 
-func (c *Cache) GetAll() map[string]RouteInfo {
+// GetAll returns all routes ordered by source, path and creation order.
+func (c *Cache) GetAll() []RouteInfo {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
-	result := make(map[string]RouteInfo)
+	result := make([]RouteInfo, 0, len(c.routes))
 
-	for key, value := range c.routes {
-		result[key] = value
+	for _, value := range c.routes {
+		result = append(result, value)
 	}
 
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].From != result[j].From {
+			return result[i].From < result[j].From
+		}
+
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+
+		return result[i].ID < result[j].ID
+	})
+
 	return result
 }
 
-func (c *Cache) Set(key string, value RouteInfo) {
+func (c *Cache) Set(value RouteInfo) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	previous := c.routes[value.ID].Targets
+
+	c.remove(value.ID)
+
+	value.Predicates = compilePredicates(value.ID, value.Predicates)
+	value.Targets = prepareTargets(value, previous)
+	value.balancer = &balancer{current: nil, m: sync.Mutex{}}
+	c.routes[value.ID] = value
+
+	// TCP routes are found by their listen port, so they never match HTTP requests.
+	if value.Type == models.RouteTypeTCP {
+		return
+	}
+
+	table, err := c.table(value, true)
+	if err != nil {
+		log.Printf("route %d will never match: %v", value.ID, err)
+
+		return
+	}
+
+	table.add(value)
+}
+
+// SetWeights changes weights of targets of the route by their ids keeping their counters.
+func (c *Cache) SetWeights(id uint, weights map[uint]int) (RouteInfo, bool) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	c.routes[key] = value
+	value, ok := c.routes[id]
+	if !ok {
+		return RouteInfo{}, false
+	}
+
+	targets := make([]Target, len(value.Targets))
+
+	for i, target := range value.Targets {
+		if weight, ok := weights[target.ID]; ok {
+			target.Weight = weight
+		}
+
+		targets[i] = target
+	}
+
+	value.Targets = targets
+	// Reset the round-robin state as it depends on the weights.
+	value.balancer = &balancer{current: nil, m: sync.Mutex{}}
+	c.routes[id] = value
+
+	return value, true
 }
 
-func (c *Cache) Exists(key string) bool {
+func (c *Cache) Exists(id uint) bool {
 	c.m.RLock()
 	defer c.m.RUnlock()
 
-	_, ok := c.routes[key]
+	_, ok := c.routes[id]
 
 	return ok
 }
 
-func (c *Cache) Remove(key string) {
+func (c *Cache) Remove(id uint) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	delete(c.routes, key)
+	c.remove(id)
+}
+
+// Origin is a list of aliases of the request address compared with routes of the mode.
+type Origin struct {
+	Mode  models.RouteMode
+	Hosts []string
+}
+
+// Match finds the route for the request with the highest priority.
+// Routes with the same priority are ordered by specificity: origins in the order they are passed,
+// then exact sources, networks from the longest prefix to the shortest (source mode only),
+// wildcards and regex sources.
+// For every source exact paths are preferred over prefixes, and longer prefixes over shorter ones.
+// Routes with predicates are only used if all their predicates match.
+func (c *Cache) Match(r *http.Request, origins ...Origin) (Match, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	var matches []Match
+
+	for _, origin := range origins {
+		matches = c.appendMatches(matches, origin.Mode, origin.Hosts, r)
+	}
+
+	if len(matches) == 0 {
+		return Match{}, false
+	}
+
+	best := matches[0]
+
+	for _, match := range matches[1:] {
+		if match.Route.Priority > best.Route.Priority {
+			best = match
+		}
+	}
+
+	return best, true
+}
+
+// Conflicts returns other routes that can match the same requests as the route
+// and that are ordered only by their creation time.
+func (c *Cache) Conflicts(value RouteInfo) []RouteInfo {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	var result []RouteInfo
+
+	for _, other := range c.routes {
+		if other.ID == value.ID ||
+			other.Type == models.RouteTypeTCP || value.Type == models.RouteTypeTCP ||
+			other.Mode != value.Mode ||
+			other.FromMatch != value.FromMatch ||
+			!sameSource(other, value) ||
+			other.Path != value.Path ||
+			other.PathMatch != value.PathMatch ||
+			other.Priority != value.Priority ||
+			!samePredicates(other.Predicates, value.Predicates) {
+			continue
+		}
+
+		result = append(result, other)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
+
+// sameSource reports whether sources of the routes are equal, exact sources are compared without loopback aliases.
+func sameSource(a, b RouteInfo) bool {
+	if a.FromMatch == models.FromMatchExact {
+		return canonicalHost(a.From) == canonicalHost(b.From)
+	}
+
+	return a.From == b.From
+}
+
+// appendMatches appends all routes matching one of the hosts in the order of their specificity.
+func (c *Cache) appendMatches(matches []Match, mode models.RouteMode, hosts []string, r *http.Request) []Match {
+	for _, host := range hosts {
+		matches = c.appendTable(matches, c.hosts[hostKey{mode: mode, host: host}], r, nil)
+	}
+
+	if mode == models.RouteModeSource {
+		for _, host := range hosts {
+			ip := parseAddressIP(host)
+			if ip == nil {
+				continue
+			}
+
+			for _, table := range c.networks.lookup(ip) {
+				matches = c.appendTable(matches, table, r, nil)
+			}
+		}
+	}
+
+	// A wildcard matches a single label, so the capture can't add labels to targets.
+	for _, host := range hosts {
+		if i := strings.IndexByte(host, '.'); i > 0 {
+			table := c.wildcards[hostKey{mode: mode, host: host[i:]}]
+			matches = c.appendTable(matches, table, r, map[string]string{"1": host[:i]})
+		}
+	}
+
+	for _, pattern := range c.patterns {
+		if pattern.key.mode != mode {
+			continue
+		}
+
+		for _, host := range hosts {
+			submatches := pattern.re.FindStringSubmatch(host)
+			if submatches == nil {
+				continue
+			}
+
+			matches = c.appendTable(matches, pattern.table, r, regexCaptures(pattern.re, submatches))
+		}
+	}
+
+	return matches
+}
+
+func (c *Cache) appendTable(matches []Match, table *pathTable, r *http.Request, captures map[string]string) []Match {
+	if table == nil {
+		return matches
+	}
+
+	for _, ref := range table.match(r.URL.Path) {
+		info := c.routes[ref.id]
+		if !predicatesMatch(info.Predicates, r) {
+			continue
+		}
+
+		path, rawPath := info.forwardedPath(r.URL)
+
+		matches = append(matches, Match{
+			Route:    info,
+			Path:     path,
+			RawPath:  rawPath,
+			Captures: captures,
+		})
+	}
+
+	return matches
+}
+
+// table returns the path table for the source of the route, creating it if needed.
+func (c *Cache) table(value RouteInfo, create bool) (*pathTable, error) {
+	switch value.FromMatch {
+	case models.FromMatchWildcard:
+		return tableFor(c.wildcards, hostKey{mode: value.Mode, host: value.From[1:]}, create), nil
+	case models.FromMatchRegex:
+		key := hostKey{mode: value.Mode, host: value.From}
+
+		for _, pattern := range c.patterns {
+			if pattern.key == key {
+				return pattern.table, nil
+			}
+		}
+
+		if !create {
+			return nil, nil //nolint:nilnil
+		}
+
+		re, err := CompileHostPattern(value.From)
+		if err != nil {
+			return nil, err
+		}
+
+		pattern := &hostPattern{key: key, re: re, table: newPathTable()}
+		c.patterns = append(c.patterns, pattern)
+
+		return pattern.table, nil
+	case models.FromMatchCIDR:
+		if value.Mode != models.RouteModeSource {
+			return nil, fmt.Errorf("network %q can only be used as a source address: %w", value.From, ErrInvalidPattern)
+		}
+
+		_, network, err := net.ParseCIDR(value.From)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing network %q: %w", value.From, err)
+		}
+
+		return c.networks.table(network, create), nil
+	case models.FromMatchExact:
+		return tableFor(c.hosts, hostKey{mode: value.Mode, host: value.From}, create), nil
+	default:
+		return nil, fmt.Errorf("unknown source match %q: %w", value.FromMatch, ErrInvalidPattern)
+	}
+}
+
+func (c *Cache) remove(id uint) {
+	value, ok := c.routes[id]
+	if !ok {
+		return
+	}
+
+	delete(c.routes, id)
+
+	if value.Type == models.RouteTypeTCP {
+		return
+	}
+
+	table, _ := c.table(value, false)
+	if table == nil {
+		return
+	}
+
+	table.remove(value)
+
+	if !table.empty() {
+		return
+	}
+
+	switch value.FromMatch {
+	case models.FromMatchWildcard:
+		delete(c.wildcards, hostKey{mode: value.Mode, host: value.From[1:]})
+	case models.FromMatchRegex:
+		for i, pattern := range c.patterns {
+			if pattern.table == table {
+				c.patterns = append(c.patterns[:i], c.patterns[i+1:]...)
+
+				break
+			}
+		}
+	case models.FromMatchCIDR:
+		_, network, _ := net.ParseCIDR(value.From)
+		c.networks.prune(network)
+	case models.FromMatchExact:
+		delete(c.hosts, hostKey{mode: value.Mode, host: value.From})
+	}
+}
+
+func tableFor(tables map[hostKey]*pathTable, key hostKey, create bool) *pathTable {
+	table, ok := tables[key]
+	if !ok && create {
+		table = newPathTable()
+		tables[key] = table
+	}
+
+	return table
 }
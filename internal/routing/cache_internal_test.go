@@ -0,0 +1,263 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:funlen
+func TestCache_Match(t *testing.T) {
+	t.Parallel()
+
+	routes := []models.Route{
+		{From: "host", To: "root", Path: "/"},                                                              //nolint:exhaustivestruct
+		{From: "host", To: "api", Path: "/api"},                                                            //nolint:exhaustivestruct
+		{From: "host", To: "users", Path: "/api/users/", StripPrefix: true},                                //nolint:exhaustivestruct
+		{From: "host", To: "health", Path: "/api/health", PathMatch: models.PathMatchExact},                //nolint:exhaustivestruct
+		{From: "host", To: "static", Path: "/static", StripPrefix: true},                                   //nolint:exhaustivestruct
+		{From: "other", To: "other", Path: "/other", Mode: models.RouteModeHost},                           //nolint:exhaustivestruct
+		{From: "host", To: "newer root", Path: "/", PathMatch: models.PathMatchPrefix, StripPrefix: false}, //nolint:exhaustivestruct
+	}
+
+	cache := New()
+
+	for i, route := range routes {
+		route.ID = uint(i + 1)
+		cache.Set(NewRouteInfo(route))
+	}
+
+	tests := []struct {
+		name string
+		mode models.RouteMode
+		host string
+		path string
+		to   string
+		rest string
+		ok   bool
+	}{
+		{name: "root", mode: models.RouteModeSource, host: "host", path: "/", to: "newer root", rest: "/", ok: true},
+		{name: "unknown path", mode: models.RouteModeSource, host: "host", path: "/unknown", to: "newer root", rest: "/unknown", ok: true},
+		{name: "prefix", mode: models.RouteModeSource, host: "host", path: "/api/v1", to: "api", rest: "/api/v1", ok: true},
+		{name: "prefix at segment boundary", mode: models.RouteModeSource, host: "host", path: "/apis", to: "newer root", rest: "/apis", ok: true},
+		{name: "longest prefix", mode: models.RouteModeSource, host: "host", path: "/api/users/1", to: "users", rest: "/1", ok: true},
+		{name: "exact", mode: models.RouteModeSource, host: "host", path: "/api/health", to: "health", rest: "/api/health", ok: true},
+		{name: "exact mismatch", mode: models.RouteModeSource, host: "host", path: "/api/health/db", to: "api", rest: "/api/health/db", ok: true},
+		{name: "strip prefix", mode: models.RouteModeSource, host: "host", path: "/static", to: "static", rest: "/", ok: true},
+		{name: "other mode", mode: models.RouteModeHost, host: "host", path: "/", to: "", rest: "", ok: false},
+		{name: "no matching path", mode: models.RouteModeHost, host: "other", path: "/", to: "", rest: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			got, ok := cache.Match(r, Origin{Mode: tt.mode, Hosts: []string{tt.host}})
+
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.to, got.Route.To)
+			assert.Equal(t, tt.rest, got.Path)
+		})
+	}
+}
+
+//nolint:funlen
+func TestCache_MatchPatterns(t *testing.T) {
+	t.Parallel()
+
+	routes := []models.Route{
+		{From: `pr-(?P<id>\d+)\.dev\.local`, FromMatch: models.FromMatchRegex, To: "pr-{id}.svc:8080"}, //nolint:exhaustivestruct
+		{From: "*.dev.local", FromMatch: models.FromMatchWildcard, To: "{1}.svc"},                      //nolint:exhaustivestruct
+		{From: "*.api.dev.local", FromMatch: models.FromMatchWildcard, To: "api-{1}.svc"},              //nolint:exhaustivestruct
+		{From: "main.dev.local", To: "main.svc"},                                                       //nolint:exhaustivestruct
+		{From: `(\w+)\.test`, FromMatch: models.FromMatchRegex, To: "{1}.svc", Path: "/api"},           //nolint:exhaustivestruct
+	}
+
+	cache := New()
+
+	for i, route := range routes {
+		route.ID = uint(i + 1)
+		cache.Set(NewRouteInfo(route))
+	}
+
+	tests := []struct {
+		name  string
+		hosts []string
+		path  string
+		to    string
+		ok    bool
+	}{
+		{name: "exact first", hosts: []string{"main.dev.local"}, path: "/", to: "main.svc", ok: true},
+		{name: "wildcard before regex", hosts: []string{"pr-1.dev.local"}, path: "/", to: "pr-1.svc", ok: true},
+		{name: "longest wildcard", hosts: []string{"v1.api.dev.local"}, path: "/", to: "api-v1.svc", ok: true},
+		{name: "wildcard matches one label", hosts: []string{"a.b.dev.local"}, path: "/", to: "", ok: false},
+		{name: "wildcard needs subdomain", hosts: []string{"dev.local"}, path: "/", to: "", ok: false},
+		{name: "regex", hosts: []string{"x.test:8080", "x.test"}, path: "/api", to: "x.svc", ok: true},
+		{name: "regex ignores case", hosts: []string{"X.Test"}, path: "/api", to: "X.svc", ok: true},
+		{name: "regex matches whole host", hosts: []string{"x.test.com"}, path: "/api", to: "", ok: false},
+		{name: "regex path", hosts: []string{"x.test"}, path: "/", to: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			got, ok := cache.Match(r, Origin{Mode: models.RouteModeSource, Hosts: tt.hosts})
+
+			assert.Equal(t, tt.ok, ok)
+
+			if ok {
+				assert.Equal(t, tt.to, got.Target())
+			}
+		})
+	}
+}
+
+func TestCache_MatchPriority(t *testing.T) {
+	t.Parallel()
+
+	routes := []models.Route{
+		{From: "host", Path: "/api", To: "specific"},                                        //nolint:exhaustivestruct
+		{From: "*.host", FromMatch: models.FromMatchWildcard, To: "wildcard", Priority: 1},  //nolint:exhaustivestruct
+		{From: "sub.host", To: "exact", Mode: models.RouteModeHost},                         //nolint:exhaustivestruct
+		{From: "127.0.0.1", To: "source", Priority: -1},                                     //nolint:exhaustivestruct
+		{From: "host", Path: "/api", To: "conflict"},                                        //nolint:exhaustivestruct
+		{From: "host", Path: "/api", To: "higher", Priority: 2, Mode: models.RouteModeHost}, //nolint:exhaustivestruct
+	}
+
+	cache := New()
+
+	for i, route := range routes {
+		route.ID = uint(i + 1)
+		cache.Set(NewRouteInfo(route))
+	}
+
+	match := func(path string, origins ...Origin) string {
+		got, _ := cache.Match(httptest.NewRequest(http.MethodGet, path, nil), origins...)
+
+		return got.Route.To
+	}
+
+	source := Origin{Mode: models.RouteModeSource, Hosts: []string{"127.0.0.1"}}
+
+	assert.Equal(t, "wildcard", match("/", Origin{Mode: models.RouteModeSource, Hosts: []string{"sub.host"}}))
+	assert.Equal(t, "exact", match("/", source, Origin{Mode: models.RouteModeHost, Hosts: []string{"sub.host"}}))
+	assert.Equal(t, "source", match("/", source))
+	assert.Equal(t, "conflict", match("/api", Origin{Mode: models.RouteModeSource, Hosts: []string{"host"}}))
+	assert.Equal(t, "higher", match("/api", source, Origin{Mode: models.RouteModeHost, Hosts: []string{"host"}}))
+
+	conflicts := cache.Conflicts(NewRouteInfo(models.Route{From: "host", Path: "/api"})) //nolint:exhaustivestruct
+	if assert.Len(t, conflicts, 2) {
+		assert.Equal(t, "specific", conflicts[0].To)
+		assert.Equal(t, "conflict", conflicts[1].To)
+	}
+}
+
+//nolint:funlen
+func TestCache_Conflicts(t *testing.T) {
+	t.Parallel()
+
+	header := func(value string) models.Predicate {
+		return models.Predicate{Kind: models.PredicateKindHeader, Name: "X-Env", Op: models.PredicateOpEquals, Value: value} //nolint:exhaustivestruct,lll
+	}
+
+	existing := models.Route{From: "localhost:8080", Predicates: []models.Predicate{header("a")}} //nolint:exhaustivestruct
+	existing.ID = 1
+
+	cache := New()
+	cache.Set(NewRouteInfo(existing))
+
+	tests := []struct {
+		name     string
+		route    models.Route
+		conflict bool
+	}{
+		{
+			name:     "same route",
+			route:    models.Route{From: "localhost:8080", Predicates: []models.Predicate{header("a")}}, //nolint:exhaustivestruct
+			conflict: true,
+		},
+		{
+			name:     "loopback alias",
+			route:    models.Route{From: "[::1]:8080", Predicates: []models.Predicate{header("a")}}, //nolint:exhaustivestruct
+			conflict: true,
+		},
+		{
+			name: "header name in other case",
+			route: models.Route{From: "127.0.0.1:8080", Predicates: []models.Predicate{ //nolint:exhaustivestruct
+				{Kind: models.PredicateKindHeader, Name: "x-env", Op: models.PredicateOpEquals, Value: "a"}, //nolint:exhaustivestruct
+			}},
+			conflict: true,
+		},
+		{
+			name:     "other predicate value",
+			route:    models.Route{From: "localhost:8080", Predicates: []models.Predicate{header("b")}}, //nolint:exhaustivestruct
+			conflict: false,
+		},
+		{
+			name:     "other port",
+			route:    models.Route{From: "localhost:8081", Predicates: []models.Predicate{header("a")}}, //nolint:exhaustivestruct
+			conflict: false,
+		},
+		{
+			name:     "without predicates",
+			route:    models.Route{From: "localhost:8080"}, //nolint:exhaustivestruct
+			conflict: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.route.ID = 2
+			conflicts := cache.Conflicts(NewRouteInfo(tt.route))
+
+			assert.Equal(t, tt.conflict, len(conflicts) == 1)
+		})
+	}
+}
+
+func TestCache_SetTCP(t *testing.T) {
+	t.Parallel()
+
+	cache := New()
+	routes := []models.Route{
+		{From: "host", To: "http"},                 //nolint:exhaustivestruct
+		{Type: models.RouteTypeTCP, To: "db:5432"}, //nolint:exhaustivestruct
+		{Type: models.RouteTypeTCP, To: "db:6379"}, //nolint:exhaustivestruct
+	}
+
+	for i, route := range routes {
+		route.ID = uint(i + 1)
+		cache.Set(NewRouteInfo(route))
+	}
+
+	// TCP routes have an empty source, but they never match requests.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, ok := cache.Match(r, Origin{Mode: models.RouteModeSource, Hosts: []string{""}})
+	assert.False(t, ok)
+
+	info, ok := cache.Get(2)
+	if assert.True(t, ok) {
+		assert.Len(t, info.Targets, 1)
+		assert.Empty(t, cache.Conflicts(info))
+	}
+
+	cache.Remove(2)
+	assert.False(t, cache.Exists(2))
+	assert.True(t, cache.Exists(3))
+}
@@ -0,0 +1,40 @@
+package routing
+
+import (
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+const (
+	defaultHealthCheckInterval = models.Duration(10 * time.Second)
+	defaultHealthCheckTimeout  = models.Duration(2 * time.Second)
+	defaultHealthyThreshold    = 2
+	defaultUnhealthyThreshold  = 3
+	defaultHealthCheckHTTPPath = "/"
+)
+
+// healthCheckDefaults fills zero settings of the enabled health check.
+func healthCheckDefaults(check models.HealthCheck) models.HealthCheck {
+	if check.Type == models.HealthCheckHTTP && check.Path == "" {
+		check.Path = defaultHealthCheckHTTPPath
+	}
+
+	if check.Interval == 0 {
+		check.Interval = defaultHealthCheckInterval
+	}
+
+	if check.Timeout == 0 {
+		check.Timeout = defaultHealthCheckTimeout
+	}
+
+	if check.HealthyThreshold == 0 {
+		check.HealthyThreshold = defaultHealthyThreshold
+	}
+
+	if check.UnhealthyThreshold == 0 {
+		check.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+
+	return check
+}
@@ -0,0 +1,137 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPattern = fmt.Errorf("invalid host pattern")
+
+//nolint:gochecknoglobals
+var placeholderRegexp = regexp.MustCompile(`{([A-Za-z0-9_]+)}`)
+
+// hostPattern is a regular expression host together with its routes.
+type hostPattern struct {
+	key   hostKey
+	re    *regexp.Regexp
+	table *pathTable
+}
+
+// CompileHostPattern compiles a regex route source so that it matches the whole address regardless of case.
+func CompileHostPattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(fmt.Sprintf("^(?i:%s)$", pattern))
+	if err != nil {
+		return nil, fmt.Errorf("error compiling host pattern %q: %w", pattern, err)
+	}
+
+	return re, nil
+}
+
+// ValidateWildcard checks that the pattern has the form "*.example.com".
+func ValidateWildcard(pattern string) error {
+	if !strings.HasPrefix(pattern, "*.") || len(pattern) == len("*.") || strings.Contains(pattern[1:], "*") {
+		return fmt.Errorf("wildcard %q must look like \"*.example.com\": %w", pattern, ErrInvalidPattern)
+	}
+
+	return nil
+}
+
+// NormalizeHost lowercases the host and removes the trailing dot of its name, keeping the port if any.
+func NormalizeHost(host string) string {
+	host = strings.ToLower(host)
+
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return strings.TrimSuffix(host, ".")
+	}
+
+	return net.JoinHostPort(strings.TrimSuffix(name, "."), port)
+}
+
+// canonicalHost replaces loopback aliases in the exact source with "localhost",
+// since requests to any of "localhost", "127.0.0.1" and "[::1]" are matched with routes of all of them.
+func canonicalHost(host string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+
+	switch strings.Trim(name, "[]") {
+	case "localhost", "127.0.0.1", "::1":
+	default:
+		return host
+	}
+
+	if port == "" {
+		return "localhost"
+	}
+
+	return net.JoinHostPort("localhost", port)
+}
+
+// CaptureNames returns names that can be used in placeholders of a regex route target.
+func CaptureNames(re *regexp.Regexp) []string {
+	var names []string
+
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+
+		names = append(names, strconv.Itoa(i))
+
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Placeholders returns names of all "{name}" placeholders in the template.
+func Placeholders(template string) []string {
+	var names []string
+
+	for _, match := range placeholderRegexp.FindAllStringSubmatch(template, -1) {
+		names = append(names, match[1])
+	}
+
+	return names
+}
+
+// Expand replaces "{name}" placeholders in the template with captured values.
+// Unknown placeholders are left untouched.
+func Expand(template string, captures map[string]string) string {
+	if len(captures) == 0 {
+		return template
+	}
+
+	return placeholderRegexp.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if value, ok := captures[placeholder[1:len(placeholder)-1]]; ok {
+			return value
+		}
+
+		return placeholder
+	})
+}
+
+func regexCaptures(re *regexp.Regexp, submatches []string) map[string]string {
+	captures := make(map[string]string, len(submatches))
+
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+
+		captures[strconv.Itoa(i)] = submatches[i]
+
+		if name != "" {
+			captures[name] = submatches[i]
+		}
+	}
+
+	return captures
+}
@@ -0,0 +1,205 @@
+package routing
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+// pathTable holds the routes of a single host.
+// Exact paths are looked up in a map, prefixes are kept sorted from the longest to the shortest,
+// so the first matching prefix is always the longest one.
+type pathTable struct {
+	exact    map[string][]routeRef
+	prefixes []prefixEntry
+}
+
+type prefixEntry struct {
+	prefix string
+	routes []routeRef
+}
+
+// routeRef points to a route in a path table.
+// Routes with more predicates are more specific, so they are checked before the others.
+type routeRef struct {
+	id          uint
+	specificity int
+}
+
+func newRouteRef(info RouteInfo) routeRef {
+	return routeRef{
+		id:          info.ID,
+		specificity: len(info.Predicates),
+	}
+}
+
+func newPathTable() *pathTable {
+	return &pathTable{
+		exact:    make(map[string][]routeRef),
+		prefixes: nil,
+	}
+}
+
+func (t *pathTable) add(info RouteInfo) {
+	ref := newRouteRef(info)
+
+	if info.PathMatch == models.PathMatchExact {
+		t.exact[info.Path] = insertRef(t.exact[info.Path], ref)
+
+		return
+	}
+
+	i := sort.Search(len(t.prefixes), func(i int) bool {
+		return len(t.prefixes[i].prefix) < len(info.Path) ||
+			len(t.prefixes[i].prefix) == len(info.Path) && t.prefixes[i].prefix >= info.Path
+	})
+
+	if i < len(t.prefixes) && t.prefixes[i].prefix == info.Path {
+		t.prefixes[i].routes = insertRef(t.prefixes[i].routes, ref)
+
+		return
+	}
+
+	t.prefixes = append(t.prefixes, prefixEntry{}) //nolint:exhaustivestruct
+	copy(t.prefixes[i+1:], t.prefixes[i:])
+	t.prefixes[i] = prefixEntry{prefix: info.Path, routes: []routeRef{ref}}
+}
+
+func (t *pathTable) remove(info RouteInfo) {
+	if info.PathMatch == models.PathMatchExact {
+		refs := removeRef(t.exact[info.Path], info.ID)
+		if len(refs) == 0 {
+			delete(t.exact, info.Path)
+		} else {
+			t.exact[info.Path] = refs
+		}
+
+		return
+	}
+
+	for i, entry := range t.prefixes {
+		if entry.prefix != info.Path {
+			continue
+		}
+
+		entry.routes = removeRef(entry.routes, info.ID)
+		if len(entry.routes) == 0 {
+			t.prefixes = append(t.prefixes[:i], t.prefixes[i+1:]...)
+		} else {
+			t.prefixes[i] = entry
+		}
+
+		return
+	}
+}
+
+func (t *pathTable) empty() bool {
+	return len(t.exact) == 0 && len(t.prefixes) == 0
+}
+
+// match returns all routes matching the path from the most specific to the least specific.
+// Routes with the same path are ordered by the number of predicates and then from the newest to the oldest.
+func (t *pathTable) match(path string) []routeRef {
+	var result []routeRef
+
+	result = append(result, t.exact[path]...)
+
+	for _, entry := range t.prefixes {
+		if hasPathPrefix(path, entry.prefix) {
+			result = append(result, entry.routes...)
+		}
+	}
+
+	return result
+}
+
+// hasPathPrefix reports whether the path starts with the prefix at a segment boundary,
+// so "/api" matches "/api" and "/api/users", but not "/apis".
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// forwardedPath returns the path that should be sent to the target of the route
+// together with its escaped form if the request used a non-default encoding (see url.URL.RawPath).
+func (i RouteInfo) forwardedPath(u *url.URL) (string, string) {
+	if !i.StripPrefix {
+		return u.Path, u.RawPath
+	}
+
+	if i.PathMatch == models.PathMatchExact {
+		return "/", ""
+	}
+
+	removed := len(strings.TrimSuffix(i.Path, "/"))
+	rest, rawRest := u.Path[removed:], ""
+
+	if u.RawPath != "" {
+		rawRest = skipEscaped(u.RawPath, removed)
+
+		if unescaped, err := url.PathUnescape(rawRest); err != nil || unescaped != rest {
+			rawRest = ""
+		}
+	}
+
+	if !strings.HasPrefix(rest, "/") {
+		rest = "/" + rest
+
+		if rawRest != "" {
+			rawRest = "/" + rawRest
+		}
+	}
+
+	return rest, rawRest
+}
+
+// skipEscaped skips n unescaped bytes at the beginning of the escaped path.
+func skipEscaped(escaped string, n int) string {
+	i := 0
+
+	for ; n > 0 && i < len(escaped); n-- {
+		if escaped[i] == '%' {
+			i += len("%00")
+		} else {
+			i++
+		}
+	}
+
+	if i > len(escaped) {
+		return ""
+	}
+
+	return escaped[i:]
+}
+
+// insertRef inserts the route keeping more specific and then newer (with larger ids) routes first.
+func insertRef(refs []routeRef, ref routeRef) []routeRef {
+	i := sort.Search(len(refs), func(i int) bool {
+		return refs[i].specificity < ref.specificity ||
+			refs[i].specificity == ref.specificity && refs[i].id <= ref.id
+	})
+	if i < len(refs) && refs[i].id == ref.id {
+		return refs
+	}
+
+	refs = append(refs, routeRef{}) //nolint:exhaustivestruct
+	copy(refs[i+1:], refs[i:])
+	refs[i] = ref
+
+	return refs
+}
+
+func removeRef(refs []routeRef, id uint) []routeRef {
+	for i, ref := range refs {
+		if ref.id == id {
+			return append(refs[:i], refs[i+1:]...)
+		}
+	}
+
+	return refs
+}
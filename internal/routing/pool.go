@@ -0,0 +1,30 @@
+package routing
+
+import (
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+const (
+	defaultMaxIdleConns = 100
+	defaultIdleTimeout  = models.Duration(90 * time.Second)
+	defaultKeepAlive    = models.Duration(30 * time.Second)
+)
+
+// poolDefaults fills zero settings of connection pools of a proxy route.
+func poolDefaults(pool models.Pool) models.Pool {
+	if pool.MaxIdleConns == 0 {
+		pool.MaxIdleConns = defaultMaxIdleConns
+	}
+
+	if pool.IdleTimeout == 0 {
+		pool.IdleTimeout = defaultIdleTimeout
+	}
+
+	if pool.KeepAlive == 0 {
+		pool.KeepAlive = defaultKeepAlive
+	}
+
+	return pool
+}
@@ -0,0 +1,205 @@
+package routing
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+var ErrInvalidPredicate = fmt.Errorf("invalid predicate")
+
+// Predicate is a condition checked after the source and the path of a route matched.
+// Regex predicates are not anchored, use "^" and "$" to match whole values.
+type Predicate struct {
+	Kind  models.PredicateKind
+	Name  string
+	Op    models.PredicateOp
+	Value string
+	re    *regexp.Regexp
+}
+
+func NewPredicate(predicate models.Predicate) Predicate {
+	return Predicate{
+		Kind:  predicate.Kind,
+		Name:  predicate.Name,
+		Op:    predicate.Op,
+		Value: predicate.Value,
+		re:    nil,
+	}
+}
+
+// Validate checks that the predicate can be evaluated.
+func (p Predicate) Validate() error {
+	switch p.Kind {
+	case models.PredicateKindHeader, models.PredicateKindCookie:
+		if p.Name == "" {
+			return fmt.Errorf("%s predicate without a name: %w", p.Kind, ErrInvalidPredicate)
+		}
+	case models.PredicateKindMethod:
+		if p.Op == models.PredicateOpPresent || p.Op == models.PredicateOpAbsent {
+			return fmt.Errorf("method is always present: %w", ErrInvalidPredicate)
+		}
+	default:
+		return fmt.Errorf("unknown predicate kind %q: %w", p.Kind, ErrInvalidPredicate)
+	}
+
+	switch p.Op {
+	case models.PredicateOpEquals, models.PredicateOpPresent, models.PredicateOpAbsent:
+		return nil
+	case models.PredicateOpRegex:
+		if _, err := regexp.Compile(p.Value); err != nil {
+			return fmt.Errorf("error compiling predicate value %q: %v: %w", p.Value, err, ErrInvalidPredicate)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown predicate operation %q: %w", p.Op, ErrInvalidPredicate)
+	}
+}
+
+func (p Predicate) String() string {
+	subject := string(p.Kind)
+	if p.Kind != models.PredicateKindMethod {
+		subject = fmt.Sprintf("%s %s", p.Kind, p.Name)
+	}
+
+	switch p.Op {
+	case models.PredicateOpPresent, models.PredicateOpAbsent:
+		return fmt.Sprintf("%s %s", subject, p.Op)
+	case models.PredicateOpEquals:
+		return fmt.Sprintf("%s = %s", subject, p.Value)
+	case models.PredicateOpRegex:
+		return fmt.Sprintf("%s ~ %s", subject, p.Value)
+	default:
+		return fmt.Sprintf("%s %s %s", subject, p.Op, p.Value)
+	}
+}
+
+// key identifies predicates matching the same requests: header names are case insensitive and so are methods.
+func (p Predicate) key() string {
+	name, value := p.Name, p.Value
+
+	if p.Kind == models.PredicateKindHeader {
+		name = http.CanonicalHeaderKey(name)
+	}
+
+	if p.Kind == models.PredicateKindMethod {
+		value = strings.ToUpper(value)
+	}
+
+	if p.Op == models.PredicateOpPresent || p.Op == models.PredicateOpAbsent {
+		value = ""
+	}
+
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s", p.Kind, name, p.Op, value)
+}
+
+// samePredicates reports whether both lists contain the same predicates in any order.
+func samePredicates(a, b []Predicate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	keys := func(predicates []Predicate) []string {
+		result := make([]string, 0, len(predicates))
+		for _, predicate := range predicates {
+			result = append(result, predicate.key())
+		}
+
+		sort.Strings(result)
+
+		return result
+	}
+
+	aKeys, bKeys := keys(a), keys(b)
+	for i := range aKeys {
+		if aKeys[i] != bKeys[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p Predicate) matches(r *http.Request) bool {
+	values := p.values(r)
+
+	switch p.Op {
+	case models.PredicateOpPresent:
+		return len(values) > 0
+	case models.PredicateOpAbsent:
+		return len(values) == 0
+	case models.PredicateOpEquals:
+		for _, value := range values {
+			if value == p.Value || p.Kind == models.PredicateKindMethod && strings.EqualFold(value, p.Value) {
+				return true
+			}
+		}
+	case models.PredicateOpRegex:
+		for _, value := range values {
+			if p.re != nil && p.re.MatchString(value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p Predicate) values(r *http.Request) []string {
+	switch p.Kind {
+	case models.PredicateKindHeader:
+		return r.Header.Values(p.Name)
+	case models.PredicateKindCookie:
+		cookie, err := r.Cookie(p.Name)
+		if err != nil {
+			return nil
+		}
+
+		return []string{cookie.Value}
+	case models.PredicateKindMethod:
+		return []string{r.Method}
+	default:
+		return nil
+	}
+}
+
+// compilePredicates returns a copy of the predicates with compiled regular expressions.
+// Predicates that fail to compile never match.
+func compilePredicates(id uint, predicates []Predicate) []Predicate {
+	if len(predicates) == 0 {
+		return nil
+	}
+
+	result := make([]Predicate, len(predicates))
+
+	for i, predicate := range predicates {
+		if predicate.Op == models.PredicateOpRegex {
+			re, err := regexp.Compile(predicate.Value)
+			if err != nil {
+				log.Printf("predicate %q of route %d will never match: %v", predicate, id, err)
+			}
+
+			predicate.re = re
+		}
+
+		result[i] = predicate
+	}
+
+	return result
+}
+
+func predicatesMatch(predicates []Predicate, r *http.Request) bool {
+	for _, predicate := range predicates {
+		if !predicate.matches(r) {
+			return false
+		}
+	}
+
+	return true
+}
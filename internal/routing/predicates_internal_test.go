@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:funlen
+func TestCache_MatchPredicates(t *testing.T) {
+	t.Parallel()
+
+	header := func(op models.PredicateOp, value string) models.Predicate {
+		return models.Predicate{Kind: models.PredicateKindHeader, Name: "X-Env", Op: op, Value: value} //nolint:exhaustivestruct
+	}
+
+	routes := []models.Route{
+		{From: "host", To: "default"}, //nolint:exhaustivestruct
+		{From: "host", To: "alice", Predicates: []models.Predicate{header(models.PredicateOpEquals, "alice")}}, //nolint:exhaustivestruct
+		{From: "host", To: "alice post", Predicates: []models.Predicate{ //nolint:exhaustivestruct
+			header(models.PredicateOpEquals, "alice"),
+			{Kind: models.PredicateKindMethod, Op: models.PredicateOpEquals, Value: "POST"}, //nolint:exhaustivestruct
+		}},
+		{From: "host", To: "canary", Predicates: []models.Predicate{ //nolint:exhaustivestruct
+			{Kind: models.PredicateKindCookie, Name: "variant", Op: models.PredicateOpRegex, Value: "^b$"}, //nolint:exhaustivestruct
+		}},
+		{From: "host", To: "any env", Path: "/env", Predicates: []models.Predicate{header(models.PredicateOpPresent, "")}}, //nolint:exhaustivestruct
+		{From: "host", To: "no env", Path: "/env", Predicates: []models.Predicate{header(models.PredicateOpAbsent, "")}},   //nolint:exhaustivestruct
+	}
+
+	cache := New()
+
+	for i, route := range routes {
+		route.ID = uint(i + 1)
+		cache.Set(NewRouteInfo(route))
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		env    string
+		cookie string
+		to     string
+	}{
+		{name: "no predicates", method: http.MethodGet, path: "/", env: "", cookie: "", to: "default"},
+		{name: "header", method: http.MethodGet, path: "/", env: "alice", cookie: "", to: "alice"},
+		{name: "most specific", method: http.MethodPost, path: "/", env: "alice", cookie: "", to: "alice post"},
+		{name: "other header value", method: http.MethodGet, path: "/", env: "bob", cookie: "", to: "default"},
+		{name: "cookie", method: http.MethodGet, path: "/", env: "", cookie: "b", to: "canary"},
+		{name: "cookie mismatch", method: http.MethodGet, path: "/", env: "", cookie: "bb", to: "default"},
+		{name: "present", method: http.MethodGet, path: "/env", env: "bob", cookie: "", to: "any env"},
+		{name: "absent", method: http.MethodGet, path: "/env", env: "", cookie: "", to: "no env"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+
+			if tt.env != "" {
+				r.Header.Set("X-Env", tt.env)
+			}
+
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "variant", Value: tt.cookie}) //nolint:exhaustivestruct
+			}
+
+			got, ok := cache.Match(r, Origin{Mode: models.RouteModeSource, Hosts: []string{"host"}})
+
+			assert.True(t, ok)
+			assert.Equal(t, tt.to, got.Route.To)
+		})
+	}
+}
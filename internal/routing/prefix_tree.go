@@ -0,0 +1,123 @@
+package routing
+
+import (
+	"net"
+)
+
+// prefixTree is a binary trie of IP networks.
+// Lookups walk the bits of the address, so they take at most 32 (IPv4) or 128 (IPv6) steps
+// regardless of the number of stored networks.
+type prefixTree struct {
+	v4 *prefixNode
+	v6 *prefixNode
+}
+
+type prefixNode struct {
+	children [2]*prefixNode
+	table    *pathTable
+}
+
+func newPrefixTree() *prefixTree {
+	return &prefixTree{
+		v4: &prefixNode{}, //nolint:exhaustivestruct
+		v6: &prefixNode{}, //nolint:exhaustivestruct
+	}
+}
+
+// table returns the path table of the network, creating it if needed.
+func (t *prefixTree) table(network *net.IPNet, create bool) *pathTable {
+	node, ip := t.root(network.IP)
+	ones, _ := network.Mask.Size()
+
+	for i := 0; i < ones; i++ {
+		bit := ipBit(ip, i)
+
+		if node.children[bit] == nil {
+			if !create {
+				return nil
+			}
+
+			node.children[bit] = &prefixNode{} //nolint:exhaustivestruct
+		}
+
+		node = node.children[bit]
+	}
+
+	if node.table == nil && create {
+		node.table = newPathTable()
+	}
+
+	return node.table
+}
+
+// lookup returns tables of all networks containing the address from the longest prefix to the shortest.
+func (t *prefixTree) lookup(address net.IP) []*pathTable {
+	node, ip := t.root(address)
+
+	var tables []*pathTable
+
+	for i := 0; node != nil; i++ {
+		if node.table != nil {
+			tables = append(tables, node.table)
+		}
+
+		if i == len(ip)*8 {
+			break
+		}
+
+		node = node.children[ipBit(ip, i)]
+	}
+
+	for i, j := 0, len(tables)-1; i < j; i, j = i+1, j-1 {
+		tables[i], tables[j] = tables[j], tables[i]
+	}
+
+	return tables
+}
+
+// prune removes the path table of the network if it is empty together with all unused nodes.
+func (t *prefixTree) prune(network *net.IPNet) {
+	root, ip := t.root(network.IP)
+	ones, _ := network.Mask.Size()
+
+	var walk func(node *prefixNode, depth int) bool
+
+	walk = func(node *prefixNode, depth int) bool {
+		if depth == ones {
+			if node.table != nil && node.table.empty() {
+				node.table = nil
+			}
+		} else if child := node.children[ipBit(ip, depth)]; child != nil && walk(child, depth+1) {
+			node.children[ipBit(ip, depth)] = nil
+		}
+
+		return node.table == nil && node.children[0] == nil && node.children[1] == nil
+	}
+
+	walk(root, 0)
+}
+
+func (t *prefixTree) root(ip net.IP) (*prefixNode, net.IP) {
+	if v4 := ip.To4(); v4 != nil {
+		return t.v4, v4
+	}
+
+	return t.v6, ip.To16()
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// parseAddressIP extracts an IP from an address that may contain a port or brackets.
+func parseAddressIP(address string) net.IP {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+
+	if len(address) > 1 && address[0] == '[' && address[len(address)-1] == ']' {
+		address = address[1 : len(address)-1]
+	}
+
+	return net.ParseIP(address)
+}
@@ -0,0 +1,88 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_MatchNetworks(t *testing.T) {
+	t.Parallel()
+
+	routes := []models.Route{
+		{From: "10.0.0.0/8", FromMatch: models.FromMatchCIDR, To: "wide"},          //nolint:exhaustivestruct
+		{From: "10.1.0.0/16", FromMatch: models.FromMatchCIDR, To: "narrow"},       //nolint:exhaustivestruct
+		{From: "10.1.2.3", To: "exact"},                                            //nolint:exhaustivestruct
+		{From: "fd00::/8", FromMatch: models.FromMatchCIDR, To: "ula"},             //nolint:exhaustivestruct
+		{From: "127.0.0.0/8", FromMatch: models.FromMatchCIDR, To: "loopback"},     //nolint:exhaustivestruct
+		{From: "0.0.0.0/0", FromMatch: models.FromMatchCIDR, To: "v4", Path: "/x"}, //nolint:exhaustivestruct
+	}
+
+	cache := New()
+
+	for i, route := range routes {
+		route.ID = uint(i + 1)
+		cache.Set(NewRouteInfo(route))
+	}
+
+	tests := []struct {
+		host string
+		path string
+		to   string
+	}{
+		{host: "10.1.2.3", path: "/", to: "exact"},
+		{host: "10.1.2.4:5000", path: "/", to: "narrow"},
+		{host: "10.2.0.1", path: "/", to: "wide"},
+		{host: "[fd12::1]:80", path: "/", to: "ula"},
+		{host: "127.0.0.1", path: "/", to: "loopback"},
+		{host: "192.168.0.1", path: "/x", to: "v4"},
+		{host: "192.168.0.1", path: "/", to: ""},
+		{host: "localhost", path: "/", to: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(fmt.Sprintf("%s%s", tt.host, tt.path), func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			got, ok := cache.Match(r, Origin{Mode: models.RouteModeSource, Hosts: []string{tt.host}})
+
+			assert.Equal(t, tt.to != "", ok)
+			assert.Equal(t, tt.to, got.Route.To)
+		})
+	}
+}
+
+func TestPrefixTree_prune(t *testing.T) {
+	t.Parallel()
+
+	tree := newPrefixTree()
+
+	_, wide, _ := net.ParseCIDR("10.0.0.0/8")
+	_, narrow, _ := net.ParseCIDR("10.1.0.0/16")
+
+	info := RouteInfo{ID: 1, Path: "/", PathMatch: models.PathMatchPrefix} //nolint:exhaustivestruct
+
+	tree.table(wide, true).add(info)
+	tree.table(narrow, true).add(info)
+
+	tree.table(narrow, false).remove(info)
+	tree.prune(narrow)
+
+	assert.Nil(t, tree.table(narrow, false))
+	assert.Len(t, tree.lookup(net.ParseIP("10.1.0.1")), 1)
+
+	tree.table(wide, false).remove(info)
+	tree.prune(wide)
+
+	assert.Nil(t, tree.v4.children[0])
+	assert.Nil(t, tree.v4.children[1])
+}
@@ -0,0 +1,156 @@
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+const (
+	defaultRetryBackoff    = models.Duration(25 * time.Millisecond)
+	defaultRetryMaxBackoff = 10 * defaultRetryBackoff
+)
+
+//nolint:gochecknoglobals
+var (
+	defaultRetryStatuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	defaultRetryErrors   = []models.RetryError{models.RetryOnConnect, models.RetryOnTimeout, models.RetryOnReset}
+)
+
+var ErrInvalidRetry = fmt.Errorf("invalid retry policy")
+
+// RetryPolicy is the retry configuration of a route with parsed lists.
+// If neither statuses nor errors are set, 502, 503, 504 and all errors are retried.
+type RetryPolicy struct {
+	Attempts      int
+	Statuses      []int
+	Errors        []models.RetryError
+	Backoff       models.Duration
+	MaxBackoff    models.Duration
+	NonIdempotent bool
+}
+
+// ParseRetry parses the retry configuration filling in default values.
+func ParseRetry(retry models.Retry) (RetryPolicy, error) {
+	policy := RetryPolicy{
+		Attempts:      retry.Attempts,
+		Statuses:      nil,
+		Errors:        nil,
+		Backoff:       retry.Backoff,
+		MaxBackoff:    retry.MaxBackoff,
+		NonIdempotent: retry.NonIdempotent,
+	}
+
+	for _, value := range splitList(retry.Statuses) {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 100 || status > 599 {
+			return RetryPolicy{}, fmt.Errorf("status code %q: %w", value, ErrInvalidRetry)
+		}
+
+		policy.Statuses = append(policy.Statuses, status)
+	}
+
+	for _, value := range splitList(retry.Errors) {
+		switch kind := models.RetryError(value); kind {
+		case models.RetryOnConnect, models.RetryOnTimeout, models.RetryOnReset:
+			policy.Errors = append(policy.Errors, kind)
+		default:
+			return RetryPolicy{}, fmt.Errorf("error kind %q: %w", value, ErrInvalidRetry)
+		}
+	}
+
+	if policy.Attempts < 0 || policy.Backoff < 0 || policy.MaxBackoff < 0 {
+		return RetryPolicy{}, fmt.Errorf("negative settings: %w", ErrInvalidRetry)
+	}
+
+	if policy.Attempts < 2 {
+		return policy, nil
+	}
+
+	if len(policy.Statuses) == 0 && len(policy.Errors) == 0 {
+		policy.Statuses = defaultRetryStatuses
+		policy.Errors = defaultRetryErrors
+	}
+
+	if policy.Backoff == 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+
+	return policy, nil
+}
+
+// Enabled reports whether requests of the method can be retried.
+func (p RetryPolicy) Enabled(method string) bool {
+	return p.Attempts > 1 && (p.NonIdempotent || isIdempotent(method))
+}
+
+// RetriesStatus reports whether responses with the status are retried.
+func (p RetryPolicy) RetriesStatus(status int) bool {
+	for _, value := range p.Statuses {
+		if value == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetriesError reports whether errors of the kind are retried.
+func (p RetryPolicy) RetriesError(kind models.RetryError) bool {
+	for _, value := range p.Errors {
+		if value == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BackoffFor returns the delay before the retry with the number starting from 1.
+func (p RetryPolicy) BackoffFor(retry int) time.Duration {
+	backoff := time.Duration(p.Backoff)
+
+	for i := 1; i < retry && backoff < time.Duration(p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+
+	if backoff > time.Duration(p.MaxBackoff) {
+		backoff = time.Duration(p.MaxBackoff)
+	}
+
+	return backoff
+}
+
+// isIdempotent reports whether the method is idempotent as defined in RFC 7231.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func splitList(s string) []string {
+	var result []string
+
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
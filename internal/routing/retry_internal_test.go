@@ -0,0 +1,124 @@
+package routing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:funlen
+func TestParseRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		retry   models.Retry
+		want    RetryPolicy
+		wantErr bool
+	}{
+		{
+			name:  "disabled",
+			retry: models.Retry{}, //nolint:exhaustivestruct
+			want:  RetryPolicy{},  //nolint:exhaustivestruct
+		},
+		{
+			name:  "defaults",
+			retry: models.Retry{Attempts: 3}, //nolint:exhaustivestruct
+			want: RetryPolicy{
+				Attempts:      3,
+				Statuses:      defaultRetryStatuses,
+				Errors:        defaultRetryErrors,
+				Backoff:       defaultRetryBackoff,
+				MaxBackoff:    defaultRetryMaxBackoff,
+				NonIdempotent: false,
+			},
+		},
+		{
+			name: "custom lists",
+			retry: models.Retry{ //nolint:exhaustivestruct
+				Attempts: 2,
+				Statuses: "500, 503",
+				Errors:   "connect",
+				Backoff:  models.Duration(time.Second),
+			},
+			want: RetryPolicy{
+				Attempts:      2,
+				Statuses:      []int{http.StatusInternalServerError, http.StatusServiceUnavailable},
+				Errors:        []models.RetryError{models.RetryOnConnect},
+				Backoff:       models.Duration(time.Second),
+				MaxBackoff:    models.Duration(time.Second),
+				NonIdempotent: false,
+			},
+		},
+		{
+			name:    "invalid status",
+			retry:   models.Retry{Attempts: 2, Statuses: "5xx"}, //nolint:exhaustivestruct
+			wantErr: true,
+		},
+		{
+			name:    "invalid error",
+			retry:   models.Retry{Attempts: 2, Errors: "refused"}, //nolint:exhaustivestruct
+			wantErr: true,
+		},
+		{
+			name:    "negative backoff",
+			retry:   models.Retry{Attempts: 2, Backoff: -1}, //nolint:exhaustivestruct
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseRetry(tt.retry)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRetry)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRetryPolicy_BackoffFor(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{ //nolint:exhaustivestruct
+		Backoff:    models.Duration(10 * time.Millisecond),
+		MaxBackoff: models.Duration(50 * time.Millisecond),
+	}
+
+	var got []time.Duration
+	for retry := 1; retry <= 4; retry++ {
+		got = append(got, policy.BackoffFor(retry))
+	}
+
+	assert.Equal(t, []time.Duration{
+		10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond,
+	}, got)
+}
+
+func TestRetryPolicy_Enabled(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{Attempts: 2} //nolint:exhaustivestruct
+
+	assert.True(t, policy.Enabled(http.MethodGet))
+	assert.True(t, policy.Enabled(http.MethodPut))
+	assert.False(t, policy.Enabled(http.MethodPost))
+
+	policy.NonIdempotent = true
+	assert.True(t, policy.Enabled(http.MethodPost))
+
+	policy.Attempts = 1
+	assert.False(t, policy.Enabled(http.MethodGet))
+}
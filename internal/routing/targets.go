@@ -0,0 +1,423 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+// Target is an upstream of a proxy or TCP route.
+type Target struct {
+	ID      uint
+	Address string
+	// Weight is the share of requests sent to the target relative to other targets, zero disables it.
+	Weight int
+	state  *targetState
+	// route is the id of the route used in logs.
+	route          uint
+	circuitBreaker models.CircuitBreaker
+	// trial is the id of the trial request if the target was picked for one.
+	trial uint64
+}
+
+// targetState is shared by all copies of the target stored in the cache
+// and is kept when the route is replaced with a target with the same id and address.
+type targetState struct {
+	// active is the number of requests in progress.
+	active int64
+	// requests is the number of requests sent to the target.
+	requests int64
+	// unhealthy is set to 1 when health checks of the target fail.
+	unhealthy int32
+	breaker   *breaker
+}
+
+// TargetStats contains counters of a target.
+type TargetStats struct {
+	Active   int64 `json:"active"`
+	Requests int64 `json:"requests"`
+}
+
+func NewTarget(target models.Target) Target {
+	return Target{
+		ID:             target.ID,
+		Address:        target.Address,
+		Weight:         target.Weight,
+		state:          nil,
+		route:          target.RouteID,
+		circuitBreaker: models.CircuitBreaker{Failures: 0, Ejection: 0, MaxEjection: 0},
+		trial:          0,
+	}
+}
+
+// Report records whether the target responded successfully for the circuit breaker of the route.
+// Responses with 5xx codes and connection errors are failures.
+func (t Target) Report(success bool) {
+	if t.state == nil || t.circuitBreaker.Failures == 0 {
+		return
+	}
+
+	t.state.breaker.report(t, success, time.Now())
+}
+
+// Done must be called when the request sent to the target completes.
+func (t Target) Done() {
+	if t.state != nil {
+		atomic.AddInt64(&t.state.active, -1)
+		t.state.breaker.release(t)
+	}
+}
+
+// Circuit returns the state of the circuit breaker of the target.
+func (t Target) Circuit() Circuit {
+	if t.state == nil {
+		return newBreaker().snapshot()
+	}
+
+	return t.state.breaker.snapshot()
+}
+
+// Stats returns counters of the target, they are zero for targets that are not stored in the cache.
+func (t Target) Stats() TargetStats {
+	if t.state == nil {
+		return TargetStats{Active: 0, Requests: 0}
+	}
+
+	return TargetStats{
+		Active:   atomic.LoadInt64(&t.state.active),
+		Requests: atomic.LoadInt64(&t.state.requests),
+	}
+}
+
+// available reports whether the target passes its health checks and is not ejected by the circuit breaker.
+func (t Target) available(now time.Time) bool {
+	return t.Healthy() && (t.state == nil || t.state.breaker.available(now))
+}
+
+// Healthy reports whether the target passes its health checks, targets without checks are always healthy.
+func (t Target) Healthy() bool {
+	return t.state == nil || atomic.LoadInt32(&t.state.unhealthy) == 0
+}
+
+// SetHealthy changes the health of the target and reports whether it changed.
+func (t Target) SetHealthy(healthy bool) bool {
+	if t.state == nil {
+		return false
+	}
+
+	var value int32
+	if !healthy {
+		value = 1
+	}
+
+	return atomic.SwapInt32(&t.state.unhealthy, value) != value
+}
+
+// MarshalJSON adds the current health to the target.
+func (t Target) MarshalJSON() ([]byte, error) {
+	type target Target
+
+	b, err := json.Marshal(struct {
+		target
+		Healthy bool
+		Circuit Circuit
+	}{
+		target:  target(t),
+		Healthy: t.Healthy(),
+		Circuit: t.Circuit(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling target: %w", err)
+	}
+
+	return b, nil
+}
+
+// balancer holds the state of the balancing strategy of a route.
+type balancer struct {
+	// current holds weights of the smooth weighted round-robin.
+	current []int
+	m       sync.Mutex
+}
+
+// prepareTargets returns a copy of the targets of the route with the state of the same previous targets
+// or a fresh one.
+func prepareTargets(value RouteInfo, previous []Target) []Target {
+	if len(value.Targets) == 0 {
+		return nil
+	}
+
+	result := make([]Target, len(value.Targets))
+
+	for i, target := range value.Targets {
+		target.route = value.ID
+		target.circuitBreaker = value.CircuitBreaker
+		target.state = &targetState{active: 0, requests: 0, unhealthy: 0, breaker: newBreaker()}
+
+		for _, old := range previous {
+			if old.ID == target.ID && old.Address == target.Address && old.state != nil {
+				target.state = old.state
+
+				break
+			}
+		}
+
+		result[i] = target
+	}
+
+	return result
+}
+
+// Pick chooses the target for the request using the balancing strategy of the route.
+// Targets with zero weight, unhealthy and ejected targets are never chosen.
+// Target.Report should be called once the target responds, and Target.Done once the request completes.
+func (r RouteInfo) Pick(req *http.Request) (Target, bool) {
+	return r.pick(clientIP(req.RemoteAddr), func() string {
+		return req.Header.Get(r.BalanceHeader)
+	})
+}
+
+// PickConn chooses the target for a connection of a TCP route from the address of the client like Pick.
+// Target.Report should be called once the target is connected, and Target.Done once the connection is closed.
+func (r RouteInfo) PickConn(remoteAddr string) (Target, bool) {
+	return r.pick(clientIP(remoteAddr), func() string {
+		return ""
+	})
+}
+
+// pick chooses the target for the client, the header is only read for hash-header balancing.
+// Targets that can't be reserved because another request took their trial are skipped.
+func (r RouteInfo) pick(ip string, header func() string) (Target, bool) {
+	if r.balancer == nil {
+		return Target{}, false
+	}
+
+	now := time.Now()
+
+	for targets := available(r.Targets, now); totalWeight(targets) != 0; {
+		target := r.choose(targets, ip, header)
+
+		if target.circuitBreaker.Failures != 0 {
+			trial, ok := target.state.breaker.acquire(target, now)
+			if !ok {
+				targets = exclude(targets, target)
+
+				continue
+			}
+
+			target.trial = trial
+		}
+
+		atomic.AddInt64(&target.state.active, 1)
+		atomic.AddInt64(&target.state.requests, 1)
+
+		return target, true
+	}
+
+	return Target{}, false
+}
+
+// choose returns one of the targets with a positive weight using the balancing strategy of the route.
+func (r RouteInfo) choose(targets []Target, ip string, header func() string) Target {
+	switch r.Balance {
+	case models.BalanceRandom:
+		return weightedRandom(targets)
+	case models.BalanceLeastConnections:
+		return r.balancer.leastConnections(targets)
+	case models.BalanceHashIP:
+		return rendezvous(targets, ip)
+	case models.BalanceHashHeader:
+		key := header()
+		if key == "" {
+			key = ip
+		}
+
+		return rendezvous(targets, key)
+	case models.BalanceRoundRobin:
+		fallthrough
+	default:
+		return r.balancer.roundRobin(targets)
+	}
+}
+
+// leastConnections returns the target with the fewest requests in progress per unit of weight.
+// Targets with equally low load share requests by their weights, so idle targets are used in turn.
+func (b *balancer) leastConnections(targets []Target) Target {
+	var best Target
+
+	for _, target := range targets {
+		if target.Weight > 0 && (best.state == nil || load(target, best) < 0) {
+			best = target
+		}
+	}
+
+	candidates := make([]Target, len(targets))
+
+	for i, target := range targets {
+		if target.Weight > 0 && load(target, best) != 0 {
+			target.Weight = 0
+		}
+
+		candidates[i] = target
+	}
+
+	return b.roundRobin(candidates)
+}
+
+// load compares requests in progress per unit of weight of the targets.
+func load(a, b Target) int64 {
+	return atomic.LoadInt64(&a.state.active)*int64(b.Weight) - atomic.LoadInt64(&b.state.active)*int64(a.Weight)
+}
+
+// roundRobin implements the smooth weighted round-robin from nginx:
+// targets are interleaved instead of sending all requests of a heavy target in a row.
+func (b *balancer) roundRobin(targets []Target) Target {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if len(b.current) != len(targets) {
+		b.current = make([]int, len(targets))
+	}
+
+	best := -1
+
+	for i, target := range targets {
+		if target.Weight <= 0 {
+			continue
+		}
+
+		b.current[i] += target.Weight
+
+		if best == -1 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+
+	b.current[best] -= totalWeight(targets)
+
+	return targets[best]
+}
+
+func weightedRandom(targets []Target) Target {
+	n := rand.Intn(totalWeight(targets)) //nolint:gosec
+
+	for _, target := range targets {
+		if target.Weight <= 0 {
+			continue
+		}
+
+		if n < target.Weight {
+			return target
+		}
+
+		n -= target.Weight
+	}
+
+	return targets[len(targets)-1]
+}
+
+// rendezvous returns the target with the highest weighted score of the key and its address (rendezvous hashing).
+// Keys only move between targets when the target they used is removed or its weight changes.
+func rendezvous(targets []Target, key string) Target {
+	var (
+		best      Target
+		bestScore = math.Inf(-1)
+	)
+
+	for _, target := range targets {
+		if target.Weight <= 0 {
+			continue
+		}
+
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(target.Address))
+
+		// Map the hash to (0, 1) and use the logarithmic method to weight it.
+		u := (float64(mix(h.Sum64())>>11) + 0.5) / (1 << 53)
+		if score := -float64(target.Weight) / math.Log(u); score > bestScore {
+			best, bestScore = target, score
+		}
+	}
+
+	return best
+}
+
+// mix is the finalizer of MurmurHash3, it spreads the last bytes written to FNV over all bits.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
+
+// available returns the targets with weights of unhealthy and ejected targets set to zero.
+// Positions of targets are kept for the round-robin state.
+func available(targets []Target, now time.Time) []Target {
+	var result []Target
+
+	for i, target := range targets {
+		if target.Weight <= 0 || target.available(now) {
+			continue
+		}
+
+		if result == nil {
+			result = append([]Target(nil), targets...)
+		}
+
+		result[i].Weight = 0
+	}
+
+	if result == nil {
+		return targets
+	}
+
+	return result
+}
+
+// exclude returns a copy of the targets with the weight of the target set to zero.
+func exclude(targets []Target, target Target) []Target {
+	result := append([]Target(nil), targets...)
+
+	for i := range result {
+		if result[i].state == target.state {
+			result[i].Weight = 0
+		}
+	}
+
+	return result
+}
+
+func totalWeight(targets []Target) int {
+	total := 0
+
+	for _, target := range targets {
+		if target.Weight > 0 {
+			total += target.Weight
+		}
+	}
+
+	return total
+}
+
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
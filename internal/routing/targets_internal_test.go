@@ -0,0 +1,298 @@
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newBalancedRoute(balance models.Balance, addresses ...string) RouteInfo {
+	weights := make([]int, len(addresses))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	return newWeightedRoute(balance, addresses, weights)
+}
+
+func newWeightedRoute(balance models.Balance, addresses []string, weights []int) RouteInfo {
+	route := models.Route{ //nolint:exhaustivestruct
+		From:          "host",
+		Type:          models.RouteTypeProxy,
+		Balance:       balance,
+		BalanceHeader: "X-User",
+	}
+
+	for i, address := range addresses {
+		route.Targets = append(route.Targets, models.Target{ //nolint:exhaustivestruct
+			Model:   gorm.Model{ID: uint(i + 1)}, //nolint:exhaustivestruct
+			Address: address,
+			Weight:  weights[i],
+		})
+	}
+
+	route.ID = 1
+
+	cache := New()
+	cache.Set(NewRouteInfo(route))
+
+	info, _ := cache.Get(1)
+
+	return info
+}
+
+func pick(t *testing.T, info RouteInfo, r *http.Request) string {
+	t.Helper()
+
+	target, ok := info.Pick(r)
+	if !ok {
+		t.Fatal("no target picked")
+	}
+
+	target.Done()
+
+	return target.Address
+}
+
+func TestRouteInfo_PickRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	info := newBalancedRoute(models.BalanceRoundRobin, "a", "b", "c")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, pick(t, info, r))
+	}
+
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, got)
+}
+
+func TestRouteInfo_PickLeastConnections(t *testing.T) {
+	t.Parallel()
+
+	info := newBalancedRoute(models.BalanceLeastConnections, "a", "b")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	busy, _ := info.Pick(r)
+	defer busy.Done()
+
+	for i := 0; i < 4; i++ {
+		assert.NotEqual(t, busy.Address, pick(t, info, r))
+	}
+}
+
+func TestRouteInfo_PickHash(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		balance models.Balance
+		request func(key string) *http.Request
+	}{
+		{
+			name:    "client address",
+			balance: models.BalanceHashIP,
+			request: func(key string) *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = "10.0.0." + key + ":1234"
+
+				return r
+			},
+		},
+		{
+			name:    "header",
+			balance: models.BalanceHashHeader,
+			request: func(key string) *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("X-User", key)
+
+				return r
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			all := newBalancedRoute(tt.balance, "a", "b", "c")
+			reduced := newBalancedRoute(tt.balance, "a", "c")
+
+			used := make(map[string]bool)
+
+			for _, key := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"} {
+				first := pick(t, all, tt.request(key))
+				used[first] = true
+
+				assert.Equal(t, first, pick(t, all, tt.request(key)), "same key must use the same target")
+
+				// Only keys of the removed target are moved.
+				if first != "b" {
+					assert.Equal(t, first, pick(t, reduced, tt.request(key)))
+				}
+			}
+
+			assert.Greater(t, len(used), 1, "keys must be spread between targets")
+		})
+	}
+}
+
+func TestRouteInfo_PickSingleTarget(t *testing.T) {
+	t.Parallel()
+
+	cache := New()
+	cache.Set(NewRouteInfo(models.Route{From: "host", To: "to", Type: models.RouteTypeProxy})) //nolint:exhaustivestruct
+
+	info, _ := cache.Get(0)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	assert.Equal(t, "to", pick(t, info, r))
+}
+
+func TestRouteInfo_PickWeighted(t *testing.T) {
+	t.Parallel()
+
+	const requests = 10000
+
+	balances := []models.Balance{
+		models.BalanceRoundRobin,
+		models.BalanceRandom,
+		models.BalanceLeastConnections,
+		models.BalanceHashIP,
+	}
+
+	for _, balance := range balances {
+		balance := balance
+
+		t.Run(string(balance), func(t *testing.T) {
+			t.Parallel()
+
+			info := newWeightedRoute(balance, []string{"v1", "v2", "drained"}, []int{95, 5, 0})
+
+			counts := make(map[string]int)
+
+			for i := 0; i < requests; i++ {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+
+				counts[pick(t, info, r)]++
+			}
+
+			assert.Zero(t, counts["drained"])
+			assert.InDelta(t, requests*5/100, counts["v2"], requests/100)
+
+			stats := make(map[string]int64)
+			for _, target := range info.Targets {
+				stats[target.Address] = target.Stats().Requests
+			}
+
+			assert.Equal(t, map[string]int64{
+				"v1":      int64(counts["v1"]),
+				"v2":      int64(counts["v2"]),
+				"drained": 0,
+			}, stats)
+		})
+	}
+}
+
+func TestRouteInfo_PickSmoothRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	info := newWeightedRoute(models.BalanceRoundRobin, []string{"a", "b"}, []int{2, 1})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, pick(t, info, r))
+	}
+
+	assert.Equal(t, []string{"a", "b", "a", "a", "b", "a"}, got)
+}
+
+func TestCache_SetWeights(t *testing.T) {
+	t.Parallel()
+
+	cache := New()
+	cache.Set(newWeightedRoute(models.BalanceRoundRobin, []string{"a", "b"}, []int{1, 1}))
+
+	info, _ := cache.Get(1)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	pick(t, info, r)
+	pick(t, info, r)
+
+	info, ok := cache.SetWeights(1, map[uint]int{2: 0})
+	if !ok {
+		t.Fatal("route not found")
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "a", pick(t, info, r))
+	}
+
+	assert.Equal(t, int64(4), info.Targets[0].Stats().Requests)
+	assert.Equal(t, int64(1), info.Targets[1].Stats().Requests)
+
+	_, ok = cache.SetWeights(2, map[uint]int{1: 1})
+	assert.False(t, ok)
+}
+
+func TestRouteInfo_PickNoWeight(t *testing.T) {
+	t.Parallel()
+
+	info := newWeightedRoute(models.BalanceRandom, []string{"a", "b"}, []int{0, 0})
+
+	_, ok := info.Pick(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, ok)
+}
+
+func TestRouteInfo_PickHealthy(t *testing.T) {
+	t.Parallel()
+
+	info := newBalancedRoute(models.BalanceRoundRobin, "a", "b")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	assert.True(t, info.Targets[0].SetHealthy(false))
+	assert.False(t, info.Targets[0].SetHealthy(false))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b", pick(t, info, r))
+	}
+
+	info.Targets[1].SetHealthy(false)
+
+	_, ok := info.Pick(r)
+	assert.False(t, ok)
+
+	info.Targets[0].SetHealthy(true)
+
+	assert.Equal(t, "a", pick(t, info, r))
+}
+
+func TestRouteInfo_PickConn(t *testing.T) {
+	t.Parallel()
+
+	info := newBalancedRoute(models.BalanceHashIP, "a", "b", "c")
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = ip + ":1234"
+
+		target, ok := info.PickConn(ip + ":5678")
+		if !ok {
+			t.Fatal("no target picked")
+		}
+
+		target.Done()
+
+		assert.Equal(t, pick(t, info, r), target.Address, "connections must be balanced like requests")
+	}
+}
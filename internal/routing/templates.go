@@ -0,0 +1,71 @@
+package routing
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+)
+
+const (
+	PlaceholderScheme   = "scheme"
+	PlaceholderHost     = "host"
+	PlaceholderHostname = "hostname"
+	PlaceholderPort     = "port"
+	PlaceholderPath     = "path"
+	PlaceholderRest     = "rest"
+	PlaceholderQuery    = "query"
+)
+
+// RequestPlaceholders returns names of placeholders filled from the request in redirect targets.
+func RequestPlaceholders() []string {
+	return []string{
+		PlaceholderScheme,
+		PlaceholderHost,
+		PlaceholderHostname,
+		PlaceholderPort,
+		PlaceholderPath,
+		PlaceholderRest,
+		PlaceholderQuery,
+	}
+}
+
+// IsFullTemplate reports whether the target places the path or the query of the request itself.
+func IsFullTemplate(target string) bool {
+	for _, placeholder := range Placeholders(target) {
+		switch placeholder {
+		case PlaceholderPath, PlaceholderRest, PlaceholderQuery:
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequestCaptures returns captured values of the match together with values of request placeholders.
+func RequestCaptures(schema string, match Match, r *http.Request) map[string]string {
+	captures := make(map[string]string, len(match.Captures)+len(RequestPlaceholders()))
+
+	for name, value := range match.Captures {
+		captures[name] = value
+	}
+
+	hostname, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		hostname, port = r.Host, ""
+	}
+
+	rest := match.RawPath
+	if rest == "" {
+		rest = (&url.URL{Path: match.Path}).EscapedPath() //nolint:exhaustivestruct
+	}
+
+	captures[PlaceholderScheme] = schema
+	captures[PlaceholderHost] = r.Host
+	captures[PlaceholderHostname] = hostname
+	captures[PlaceholderPort] = port
+	captures[PlaceholderPath] = r.URL.EscapedPath()
+	captures[PlaceholderRest] = rest
+	captures[PlaceholderQuery] = r.URL.RawQuery
+
+	return captures
+}
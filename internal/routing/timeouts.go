@@ -0,0 +1,30 @@
+package routing
+
+import (
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+)
+
+const (
+	defaultDialTimeout           = models.Duration(5 * time.Second)
+	defaultTLSHandshakeTimeout   = models.Duration(10 * time.Second)
+	defaultResponseHeaderTimeout = models.Duration(time.Minute)
+)
+
+// timeoutsDefaults fills zero timeouts of a proxy route, the whole request stays unlimited.
+func timeoutsDefaults(timeouts models.Timeouts) models.Timeouts {
+	if timeouts.Dial == 0 {
+		timeouts.Dial = defaultDialTimeout
+	}
+
+	if timeouts.TLSHandshake == 0 {
+		timeouts.TLSHandshake = defaultTLSHandshakeTimeout
+	}
+
+	if timeouts.ResponseHeader == 0 {
+		timeouts.ResponseHeader = defaultResponseHeaderTimeout
+	}
+
+	return timeouts
+}
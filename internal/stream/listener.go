@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// listener accepts connections of a TCP route and keeps track of them, so they're closed with the route.
+type listener struct {
+	route uint
+	port  int
+	// ln is nil while the port can't be bound.
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	m      sync.Mutex
+
+	active   int64
+	total    int64
+	bytesIn  int64
+	bytesOut int64
+}
+
+func newListener(route uint, port int) *listener {
+	return &listener{
+		route:    route,
+		port:     port,
+		ln:       nil,
+		conns:    make(map[net.Conn]struct{}),
+		closed:   false,
+		m:        sync.Mutex{},
+		active:   0,
+		total:    0,
+		bytesIn:  0,
+		bytesOut: 0,
+	}
+}
+
+func (l *listener) listening() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.ln != nil
+}
+
+func (l *listener) setListener(ln net.Listener) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.ln = ln
+}
+
+// clearListener forgets the listener after it failed, unless it was already replaced.
+func (l *listener) clearListener(ln net.Listener) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.ln == ln {
+		_ = ln.Close()
+		l.ln = nil
+	}
+}
+
+// track remembers the connection and reports whether it can be used, connections of closed listeners can't.
+func (l *listener) track(conn net.Conn) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.closed {
+		return false
+	}
+
+	l.conns[conn] = struct{}{}
+
+	return true
+}
+
+func (l *listener) untrack(conn net.Conn) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	delete(l.conns, conn)
+
+	_ = conn.Close()
+}
+
+// close stops accepting connections and closes all connections of clients and targets.
+func (l *listener) close() {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.closed = true
+
+	if l.ln != nil {
+		_ = l.ln.Close()
+		l.ln = nil
+	}
+
+	for conn := range l.conns {
+		_ = conn.Close()
+	}
+}
+
+func (l *listener) stats() Stats {
+	l.m.Lock()
+	listening := l.ln != nil
+	l.m.Unlock()
+
+	return Stats{
+		Listening: listening,
+		Active:    atomic.LoadInt64(&l.active),
+		Total:     atomic.LoadInt64(&l.total),
+		BytesIn:   atomic.LoadInt64(&l.bytesIn),
+		BytesOut:  atomic.LoadInt64(&l.bytesOut),
+	}
+}
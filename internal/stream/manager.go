@@ -0,0 +1,268 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+)
+
+// resolution is how often the manager binds ports that were busy when their routes were added.
+const resolution = 10 * time.Second
+
+// Temporary accept errors (e.g. too many open files) are retried with a backoff growing between these delays,
+// the same way http.Server does.
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// Manager runs listeners of TCP routes and copies bytes between accepted connections and targets of the routes.
+// Sync must be called after TCP routes are added or removed, Run also calls it periodically.
+type Manager struct {
+	routes    *routing.Cache
+	workers   *sync.WaitGroup
+	listeners map[uint]*listener
+	closed    bool
+	m         sync.Mutex
+	// ctx is canceled when the manager is closed, so pending connections to targets don't delay shutdown.
+	ctx    context.Context //nolint:containedctx
+	cancel context.CancelFunc
+}
+
+// Stats contains counters of the listener of a TCP route, they are kept while the route exists.
+type Stats struct {
+	// Listening is false while the port can't be bound.
+	Listening bool  `json:"listening"`
+	Active    int64 `json:"active"`
+	Total     int64 `json:"total"`
+	// BytesIn are received from clients and BytesOut are sent to them.
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+}
+
+func NewManager(routes *routing.Cache, workers *sync.WaitGroup) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		routes:    routes,
+		workers:   workers,
+		listeners: make(map[uint]*listener),
+		closed:    false,
+		m:         sync.Mutex{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Run keeps listeners in sync with routes until the context is canceled, then closes all listeners and connections.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	m.Sync()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.close()
+
+			return
+		case <-ticker.C:
+			m.Sync()
+		}
+	}
+}
+
+// Sync starts listeners of new TCP routes and closes listeners of removed ones with all their connections.
+func (m *Manager) Sync() {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	ports := make(map[uint]int)
+
+	for _, info := range m.routes.GetAll() {
+		if info.Type == models.RouteTypeTCP {
+			ports[info.ID] = info.ListenPort
+		}
+	}
+
+	// Removed listeners are closed first, so their ports can be reused by new routes.
+	for id, l := range m.listeners {
+		if port, ok := ports[id]; !ok || port != l.port {
+			l.close()
+			delete(m.listeners, id)
+
+			log.Printf("tcp listener of route %d on port %d closed", id, l.port)
+		}
+	}
+
+	for id, port := range ports {
+		l, ok := m.listeners[id]
+		if !ok {
+			l = newListener(id, port)
+			m.listeners[id] = l
+		}
+
+		if !l.listening() {
+			m.listen(l)
+		}
+	}
+}
+
+// Stats returns counters of listeners by ids of their routes.
+func (m *Manager) Stats() map[uint]Stats {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	result := make(map[uint]Stats, len(m.listeners))
+
+	for id, l := range m.listeners {
+		result[id] = l.stats()
+	}
+
+	return result
+}
+
+func (m *Manager) close() {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.closed = true
+	m.cancel()
+
+	for id, l := range m.listeners {
+		l.close()
+		delete(m.listeners, id)
+	}
+}
+
+func (m *Manager) listen(l *listener) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", l.port))
+	if err != nil {
+		log.Printf("error listening on port %d for route %d, retrying in %v: %v", l.port, l.route, resolution, err)
+
+		return
+	}
+
+	l.setListener(ln)
+
+	log.Printf("tcp listener of route %d on port %d started", l.route, l.port)
+
+	m.workers.Add(1)
+
+	go func() {
+		defer m.workers.Done()
+
+		m.serve(l, ln)
+	}()
+}
+
+func (m *Manager) serve(l *listener, ln net.Listener) {
+	var delay time.Duration
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() { //nolint:staticcheck
+				delay = min(max(2*delay, minAcceptDelay), maxAcceptDelay)
+
+				log.Printf("error accepting connection of route %d, retrying in %v: %v", l.route, delay, err)
+
+				select {
+				case <-m.ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+
+				continue
+			}
+
+			// The port is bound again by the next Sync.
+			log.Printf("error accepting connection of route %d: %v", l.route, err)
+			l.clearListener(ln)
+
+			return
+		}
+
+		delay = 0
+
+		if !l.track(conn) {
+			_ = conn.Close()
+
+			return
+		}
+
+		atomic.AddInt64(&l.active, 1)
+		atomic.AddInt64(&l.total, 1)
+
+		m.workers.Add(1)
+
+		go func() {
+			defer m.workers.Done()
+			defer atomic.AddInt64(&l.active, -1)
+			defer l.untrack(conn)
+
+			m.handle(l, conn)
+		}()
+	}
+}
+
+// handle connects the client to a target of the route and copies bytes until both sides are done.
+func (m *Manager) handle(l *listener, client net.Conn) {
+	info, ok := m.routes.Get(l.route)
+	if !ok || info.Type != models.RouteTypeTCP {
+		return
+	}
+
+	target, ok := info.PickConn(client.RemoteAddr().String())
+	if !ok {
+		log.Printf("no available targets for tcp route %d", info.ID)
+
+		return
+	}
+
+	defer target.Done()
+
+	dialer := net.Dialer{Timeout: time.Duration(info.Timeouts.Dial)} //nolint:exhaustivestruct
+
+	upstream, err := dialer.DialContext(m.ctx, "tcp", target.Address)
+	if err != nil && m.ctx.Err() != nil {
+		// The manager is closing, that says nothing about the target.
+		return
+	}
+
+	target.Report(err == nil)
+
+	if err != nil {
+		log.Printf("error connecting to target %q of tcp route %d: %v", target.Address, info.ID, err)
+
+		return
+	}
+
+	if !l.track(upstream) {
+		_ = upstream.Close()
+
+		return
+	}
+
+	defer l.untrack(upstream)
+
+	splice(client, upstream, &l.bytesIn, &l.bytesOut)
+}
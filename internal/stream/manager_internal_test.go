@@ -0,0 +1,291 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/iskorotkov/router/internal/models"
+	"github.com/iskorotkov/router/internal/routing"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// newEchoServer returns the address of a server sending lines back and closing after the client stops writing.
+func newEchoServer(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert
+}
+
+func newTCPRoute(id uint, port int, to string) routing.RouteInfo {
+	return routing.NewRouteInfo(models.Route{ //nolint:exhaustivestruct
+		Model:      gorm.Model{ID: id}, //nolint:exhaustivestruct
+		To:         to,
+		Type:       models.RouteTypeTCP,
+		ListenPort: port,
+	})
+}
+
+//nolint:funlen
+func TestManager_Sync(t *testing.T) {
+	t.Parallel()
+
+	routes := routing.New()
+	port := freePort(t)
+	routes.Set(newTCPRoute(1, port, newEchoServer(t)))
+
+	var workers sync.WaitGroup
+
+	m := NewManager(&routes, &workers)
+	m.Sync()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping\n"))
+	assert.NoError(t, err)
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+
+	assert.Equal(t, Stats{Listening: true, Active: 1, Total: 1, BytesIn: 5, BytesOut: 5}, m.Stats()[1])
+
+	// Deleting the route closes the listener with its connections.
+	routes.Remove(1)
+	m.Sync()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	assert.Error(t, err)
+	assert.Empty(t, m.Stats())
+
+	workers.Wait()
+}
+
+func TestManager_Run(t *testing.T) {
+	t.Parallel()
+
+	routes := routing.New()
+	port := freePort(t)
+
+	// The port is busy until the manager retries it.
+	busy, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes.Set(newTCPRoute(1, port, newEchoServer(t)))
+
+	var workers sync.WaitGroup
+
+	m := NewManager(&routes, &workers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	workers.Add(1)
+
+	go func() {
+		defer workers.Done()
+
+		m.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		stats, ok := m.Stats()[1]
+
+		return ok && !stats.Listening
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_ = busy.Close()
+	m.Sync()
+
+	assert.True(t, m.Stats()[1].Listening)
+
+	cancel()
+	workers.Wait()
+
+	// Routes added after the manager stopped aren't served.
+	routes.Set(newTCPRoute(2, freePort(t), newEchoServer(t)))
+	m.Sync()
+
+	assert.Empty(t, m.Stats())
+}
+
+// flakyListener fails the first accept with a temporary error, like one hitting the limit of open files.
+type flakyListener struct {
+	net.Listener
+	failed atomic.Bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if !l.failed.Swap(true) {
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE} //nolint:exhaustivestruct
+	}
+
+	return l.Listener.Accept() //nolint:wrapcheck
+}
+
+func TestManager_serveTemporaryError(t *testing.T) {
+	t.Parallel()
+
+	routes := routing.New()
+	routes.Set(newTCPRoute(1, 0, newEchoServer(t)))
+
+	var workers sync.WaitGroup
+
+	m := NewManager(&routes, &workers)
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln := &flakyListener{Listener: inner} //nolint:exhaustivestruct
+
+	l := newListener(1, 0)
+	l.setListener(ln)
+
+	workers.Add(1)
+
+	go func() {
+		defer workers.Done()
+
+		m.serve(l, ln)
+	}()
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping\n"))
+	assert.NoError(t, err)
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+	assert.True(t, l.listening(), "temporary errors must not close the listener")
+
+	l.close()
+	workers.Wait()
+}
+
+// tcpPair returns both ends of a TCP connection.
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	dialed, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = dialed.Close()
+		_ = accepted.Close()
+	})
+
+	return dialed.(*net.TCPConn), accepted.(*net.TCPConn) //nolint:forcetypeassert
+}
+
+func TestSplice(t *testing.T) {
+	t.Parallel()
+
+	client, clientPeer := tcpPair(t)
+	upstreamPeer, upstream := tcpPair(t)
+
+	var received, sent int64
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		splice(clientPeer, upstreamPeer, &received, &sent)
+	}()
+
+	// The client finishes sending first and still gets the response.
+	_, _ = client.Write([]byte("hi"))
+	_ = client.CloseWrite()
+
+	b, err := io.ReadAll(upstream)
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", string(b))
+
+	_, _ = upstream.Write([]byte("hello"))
+	_ = upstream.Close()
+
+	b, err = io.ReadAll(client)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+
+	<-done
+
+	assert.Equal(t, int64(2), received)
+	assert.Equal(t, int64(5), sent)
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+// closeWriter is implemented by TCP connections that can be half-closed.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// splice copies bytes in both directions until both sides stop sending.
+// The end of one direction is passed on as a half-close, so protocols finishing one direction first keep working.
+// Errors close both connections. Counters are updated while bytes are copied.
+func splice(client, upstream net.Conn, received, sent *int64) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		copyHalf(upstream, client, received)
+	}()
+
+	copyHalf(client, upstream, sent)
+
+	<-done
+}
+
+func copyHalf(dst, src net.Conn, counter *int64) {
+	if _, err := io.Copy(dst, &countingReader{r: src, n: counter}); err != nil {
+		// The other direction would keep waiting for bytes otherwise.
+		_ = src.Close()
+		_ = dst.Close()
+
+		return
+	}
+
+	if c, ok := dst.(closeWriter); ok && c.CloseWrite() == nil {
+		return
+	}
+
+	_ = dst.Close()
+}
+
+// countingReader adds the number of read bytes to the counter.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+
+	return n, err //nolint:wrapcheck
+}
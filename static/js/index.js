@@ -1,12 +1,44 @@
 const frmCreateRoute = document.getElementById('frm-create-route')
 const intRouteFrom = document.getElementById('int-route-from')
+const sltRouteFromMatch = document.getElementById('slt-route-from-match')
+const intRoutePath = document.getElementById('int-route-path')
+const sltRoutePathMatch = document.getElementById('slt-route-path-match')
+const chkRouteStripPrefix = document.getElementById('chk-route-strip-prefix')
+const chkRouteACME = document.getElementById('chk-route-acme')
+const chkRouteHTTPSRedirect = document.getElementById('chk-route-https-redirect')
+const intRouteHSTSMaxAge = document.getElementById('int-route-hsts-max-age')
+const txtRoutePredicates = document.getElementById('txt-route-predicates')
+const intRoutePriority = document.getElementById('int-route-priority')
 const intRouteTo = document.getElementById('int-route-to')
+const sltRouteBalance = document.getElementById('slt-route-balance')
+const intRouteBalanceHeader = document.getElementById('int-route-balance-header')
+const sltRouteQueryMode = document.getElementById('slt-route-query-mode')
 const sltRouteType = document.getElementById('slt-route-type')
+const sltRouteRedirectCode = document.getElementById('slt-route-redirect-code')
+const intRouteListenPort = document.getElementById('int-route-listen-port')
+const intRouteFlushInterval = document.getElementById('int-route-flush-interval')
+const intRouteRequestTimeout = document.getElementById('int-route-request-timeout')
+const sltRouteHealthCheck = document.getElementById('slt-route-health-check')
+const intRouteHealthCheckPath = document.getElementById('int-route-health-check-path')
+const intRouteCircuitBreakerFailures = document.getElementById('int-route-circuit-breaker-failures')
+const intRouteRetryAttempts = document.getElementById('int-route-retry-attempts')
+const sltRouteUpstreamScheme = document.getElementById('slt-route-upstream-scheme')
+const intRouteUpstreamCA = document.getElementById('int-route-upstream-ca')
+const intRouteUpstreamClientCertificate = document.getElementById('int-route-upstream-client-certificate')
+const sltRouteMode = document.getElementById('slt-route-mode')
 
 const btnCreateRoute = document.getElementById('btn-create-route')
 btnCreateRoute.addEventListener('click', () => {
     intRouteFrom.value = intRouteFrom.value.trim()
+    intRoutePath.value = intRoutePath.value.trim()
     intRouteTo.value = intRouteTo.value.trim()
+    intRouteFlushInterval.value = intRouteFlushInterval.value.trim()
+    intRouteRequestTimeout.value = intRouteRequestTimeout.value.trim()
+    intRouteHSTSMaxAge.value = intRouteHSTSMaxAge.value.trim()
+
+    // TCP routes are selected by the listen port instead of the source.
+    intRouteFrom.required = sltRouteType.value !== 'tcp'
+    intRouteListenPort.required = sltRouteType.value === 'tcp'
 
     if (!frmCreateRoute.reportValidity()) {
         console.log()
@@ -14,23 +46,129 @@ btnCreateRoute.addEventListener('click', () => {
     }
 
     const from = intRouteFrom.value
-    const to = intRouteTo.value
+    const fromMatch = sltRouteFromMatch.value
+    const path = intRoutePath.value
+    const pathMatch = sltRoutePathMatch.value
+    const stripPrefix = chkRouteStripPrefix.checked
+    const acme = chkRouteACME.checked
+    const https = { redirect: chkRouteHTTPSRedirect.checked, hstsMaxAge: intRouteHSTSMaxAge.value }
+    const predicates = parsePredicates(txtRoutePredicates.value)
+    const priority = Number(intRoutePriority.value)
     const type = sltRouteType.value
+    const addresses = intRouteTo.value.split(/[\s,]+/)
+    const balanced = type === 'proxy' || type === 'tcp'
+    const to = balanced && addresses.length > 1 ? '' : intRouteTo.value
+    const targets = balanced && addresses.length > 1 ? addresses.map(parseTarget) : []
+    const balance = balanced ? sltRouteBalance.value : ''
+    const balanceHeader = balance === 'hash-header' ? intRouteBalanceHeader.value.trim() : ''
+    const queryMode = sltRouteQueryMode.value
+    const redirectCode = type === 'redirect' ? Number(sltRouteRedirectCode.value) : 0
+    const flushInterval = type === 'proxy' ? intRouteFlushInterval.value : ''
+    const healthCheckType = balanced ? sltRouteHealthCheck.value : ''
+    const healthCheck = {
+        type: healthCheckType,
+        path: healthCheckType === 'http' ? intRouteHealthCheckPath.value.trim() : ''
+    }
+    const circuitBreaker = { failures: balanced ? Number(intRouteCircuitBreakerFailures.value) : 0 }
+    const timeouts = { request: type === 'proxy' ? intRouteRequestTimeout.value : '' }
+    const retry = { attempts: type === 'proxy' ? Number(intRouteRetryAttempts.value) : 0 }
+    const upstreamTls = type === 'proxy' ? {
+        scheme: sltRouteUpstreamScheme.value,
+        ca: intRouteUpstreamCA.value.trim(),
+        clientCertificate: intRouteUpstreamClientCertificate.value.trim()
+    } : {}
+    const mode = sltRouteMode.value
+    const listenPort = Number(intRouteListenPort.value)
+
+    // HTTP settings are rejected for TCP routes.
+    const route = type === 'tcp'
+        ? { to, type, targets, balance, healthCheck, circuitBreaker, listenPort }
+        : { from, fromMatch, path, pathMatch, stripPrefix, predicates, priority, to, queryMode, type, redirectCode, flushInterval, targets, balance, balanceHeader, healthCheck, circuitBreaker, retry, timeouts, upstreamTls, https, acme, mode }
 
     fetch('/api/v1/routes', {
         method: 'POST',
-        body: JSON.stringify({ from, to, type })
-    }).then(() => document.location.reload())
+        body: JSON.stringify(route)
+    })
+        .then(resp => resp.ok ? resp.json() : Promise.reject(resp.statusText))
+        .then(({ conflicts }) => {
+            if (conflicts && conflicts.length > 0) {
+                const ids = conflicts.map(c => c.ID).join(', ')
+                alert(`Route conflicts with routes ${ids} and will be preferred as the newest one`)
+            }
+        })
+        .finally(() => document.location.reload())
 })
 
 const btnsDeleteRoute = document.getElementsByClassName('btn-delete-route')
 for (let btn of btnsDeleteRoute) {
     btn.addEventListener('click', e => {
-        const from = e.target.dataset.from
+        const id = Number(e.target.dataset.id)
 
         fetch('/api/v1/routes', {
             method: 'DELETE',
-            body: JSON.stringify({ from })
+            body: JSON.stringify({ id })
         }).then(() => document.location.reload())
     })
 }
+
+const frmCreateCertificate = document.getElementById('frm-create-certificate')
+const intCertificateName = document.getElementById('int-certificate-name')
+const txtCertificate = document.getElementById('txt-certificate')
+const txtCertificateKey = document.getElementById('txt-certificate-key')
+
+const btnCreateCertificate = document.getElementById('btn-create-certificate')
+btnCreateCertificate.addEventListener('click', () => {
+    intCertificateName.value = intCertificateName.value.trim()
+
+    if (!frmCreateCertificate.reportValidity()) {
+        return
+    }
+
+    fetch('/api/v1/certificates', {
+        method: 'POST',
+        body: JSON.stringify({ name: intCertificateName.value, certificate: txtCertificate.value, key: txtCertificateKey.value })
+    })
+        .then(resp => resp.ok ? resp.json() : Promise.reject(resp.statusText))
+        .catch(err => alert(`Certificate wasn't uploaded: ${err}`))
+        .finally(() => document.location.reload())
+})
+
+const btnsDeleteCertificate = document.getElementsByClassName('btn-delete-certificate')
+for (let btn of btnsDeleteCertificate) {
+    btn.addEventListener('click', e => {
+        const id = Number(e.target.dataset.id)
+
+        fetch('/api/v1/certificates', {
+            method: 'DELETE',
+            body: JSON.stringify({ id })
+        })
+            .then(resp => resp.ok ? resp : Promise.reject(resp.statusText))
+            .catch(err => alert(`Certificate wasn't deleted, it may be used by routes: ${err}`))
+            .finally(() => document.location.reload())
+    })
+}
+
+// Parses predicates written one per line as "<kind> <name> <op> [value]" or "method <op> <value>".
+function parsePredicates(text) {
+    return text.split('\n')
+        .map(line => line.trim())
+        .filter(line => line !== '')
+        .map(line => {
+            const parts = line.split(/\s+/)
+            if (parts[0] === 'method') {
+                return { kind: parts[0], op: parts[1], value: parts.slice(2).join(' ') }
+            }
+
+            return { kind: parts[0], name: parts[1], op: parts[2], value: parts.slice(3).join(' ') }
+        })
+}
+
+// Parses a target written as "<address>" or "<address>=<weight>".
+function parseTarget(text) {
+    const match = text.match(/^(.*)=(\d+)$/)
+    if (match) {
+        return { address: match[1], weight: Number(match[2]) }
+    }
+
+    return { address: text }
+}